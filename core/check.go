@@ -0,0 +1,284 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/pkg/errors"
+)
+
+// ConfigFiles are the configuration files of an application and the loader that loads them.
+//
+// They are bound to the application by Configuration, for use by ValidateConfig.
+type ConfigFiles struct {
+	Loader kong.ConfigurationLoader
+	Paths  []string
+	// Err is the error from the first of Paths that failed to load, if any.
+	Err error
+}
+
+// Configuration loads configuration like kong.Configuration, and also binds the files as ConfigFiles.
+//
+// The KeyStyle of the loader is recorded for DumpConfig, which writes keys in it.
+//
+// Unlike kong.Configuration, a file that fails to load does not fail kong.New, so that ValidateConfig
+// can report the problem. Otherwise the error is returned when the command line is parsed.
+func Configuration(loader kong.ConfigurationLoader, paths ...string) kong.Option {
+	return kong.OptionFunc(func(k *kong.Kong) error {
+		// Set the loader used by kong.ConfigFlag.
+		if err := kong.Configuration(loader).Apply(k); err != nil {
+			return err
+		}
+		files := ConfigFiles{Loader: loader, Paths: paths}
+		resolvers := []kong.Resolver{}
+		for _, path := range paths {
+			if _, err := os.Stat(kong.ExpandPath(path)); os.IsNotExist(err) {
+				continue
+			}
+			resolver, err := k.LoadConfig(path)
+			if err != nil {
+				files.Err = errors.Wrap(err, path)
+				resolvers = append(resolvers, &failedResolver{err: files.Err})
+				break
+			}
+			if resolver != nil {
+				resolvers = append(resolvers, resolver)
+			}
+		}
+		if err := kong.Resolvers(resolvers...).Apply(k); err != nil {
+			return err
+		}
+		if err := recordKeyStyle(loader).Apply(k); err != nil {
+			return err
+		}
+		return kong.Bind(files).Apply(k)
+	})
+}
+
+// A resolver for configuration that failed to load, which fails validation with the error.
+type failedResolver struct {
+	err error
+}
+
+func (f *failedResolver) Validate(app *kong.Application) error { return f.err } // nolint: golint
+
+func (f *failedResolver) Resolve(context *kong.Context, parent *kong.Path, flag *kong.Flag) (interface{}, error) { // nolint: golint
+	return nil, nil
+}
+
+// ValidateConfig loads each of files and reports every problem with its configuration for app,
+// returning false if there were any errors.
+//
+// Problems are written to app.Stderr in the DiagnosticsText format, and to app.Stdout in the
+// machine-readable formats. As with kong.Configuration, files that do not exist are skipped.
+func ValidateConfig(app *kong.Kong, files ConfigFiles, format DiagnosticsFormat) (bool, error) {
+	diagnostics := diagnoseFiles(app.Model, files)
+	switch format {
+	case DiagnosticsText, "":
+		if len(diagnostics.Diagnostics) > 0 {
+			_ = diagnostics.Write(app.Stderr, IsTerminal(app.Stderr))
+		}
+	default:
+		if err := diagnostics.WriteFormat(app.Stdout, format, false, app.Model.Name); err != nil {
+			return false, err
+		}
+	}
+	return !diagnostics.HasErrors(), nil
+}
+
+// Load and diagnose each of files.
+func diagnoseFiles(app *kong.Application, files ConfigFiles) *Diagnostics {
+	out := &Diagnostics{Sources: map[string][]byte{}}
+	for _, path := range files.Paths {
+		path = kong.ExpandPath(path)
+		source, err := ioutil.ReadFile(path) // nolint: gosec
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			out.Diagnostics = append(out.Diagnostics, Diagnostic{Summary: "Unreadable configuration", Detail: sentence(err.Error())})
+			continue
+		}
+		out.Sources[path] = source
+		resolver, err := files.Loader(&namedReader{Reader: bytes.NewReader(source), name: path})
+		if err != nil {
+			out.Diagnostics = append(out.Diagnostics, errorDiagnostics(path, err)...)
+			continue
+		}
+		if r, ok := resolver.(*Resolver); ok {
+			out.Diagnostics = append(out.Diagnostics, r.Diagnose(app)...)
+		} else if err := resolver.Validate(app); err != nil {
+			out.Diagnostics = append(out.Diagnostics, errorDiagnostics(path, err)...)
+		}
+	}
+	return out
+}
+
+// Diagnose returns every problem with the configuration for app, in source order.
+//
+// In addition to the problems reported by Validate, each value is decoded into a copy of its
+// flag, and any that fail are reported with RuleTypeMismatch. Unknown keys are errors in
+// ValidateStrict mode and warnings otherwise, while in ValidateIgnore mode only values that
+// fail to decode are reported.
+func (r *Resolver) Diagnose(app *kong.Application) []Diagnostic {
+	schema := r.schema(app)
+	diagnostics := r.diagnose(schema, r.config, r.root, "")
+	for _, name := range r.profileNames() {
+		context := fmt.Sprintf("profile %q: ", name)
+		diagnostics = append(diagnostics, r.diagnose(schema, r.profiles[name], []string{profileBlock, name}, context)...)
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Pos, diagnostics[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diagnostics
+}
+
+// Diagnose config, which is located at "root" in the Tree.
+func (r *Resolver) diagnose(schema *schema, config map[string]interface{}, root []string, context string) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	if r.mode != ValidateIgnore {
+		warnings, err := r.check(schema, config, root, context)
+		if err != nil {
+			return append(diagnostics, errorDiagnostics("", err)...)
+		}
+		layout := r.layout(schema)
+		for _, warning := range warnings {
+			severity := SeverityWarning
+			detail := sentence(warning.Message)
+			if warning.Rule == RuleUnknownKey {
+				if r.mode == ValidateStrict {
+					severity = SeverityError
+				}
+				if suggestions := layout.Suggest([]string{warning.Key}, false); len(suggestions) > 0 {
+					detail += fmt.Sprintf(" Did you mean %s?", QuoteList(suggestions))
+				}
+			}
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: severity,
+				Rule:     warning.Rule,
+				Summary:  summary(warning.Rule),
+				Detail:   detail,
+				Pos:      warning.Pos,
+			})
+		}
+	}
+	keys, err := r.flattenConfig(schema, root, config)
+	if err != nil {
+		return append(diagnostics, errorDiagnostics("", err)...)
+	}
+	for _, key := range sortedKeys(keys) {
+		flag := schema.flags[key]
+		if flag == nil {
+			continue
+		}
+		for _, setting := range keys[key] {
+			if err := typeCheck(flag, setting.value); err != nil {
+				pos, _ := r.tree.Position(append(append([]string{}, root...), setting.path...))
+				diagnostics = append(diagnostics, Diagnostic{
+					Rule:    RuleTypeMismatch,
+					Summary: summary(RuleTypeMismatch),
+					Detail:  sentence(fmt.Sprintf("%sinvalid value for %q: %s", context, r.style.Format(key), err)),
+					Pos:     pos,
+				})
+			}
+		}
+	}
+	return diagnostics
+}
+
+var ruleSummaries = map[string]string{ // nolint: gochecknoglobals
+	RuleUnknownKey:   "Unknown configuration key",
+	RuleDeprecated:   "Deprecated configuration key",
+	RuleShadowed:     "Overridden configuration key",
+	RuleConflict:     "Conflicting configuration keys",
+	RuleTypeMismatch: "Invalid configuration value",
+}
+
+// The summary of diagnostics for rule.
+func summary(rule string) string {
+	if summary, ok := ruleSummaries[rule]; ok {
+		return summary
+	}
+	return "Invalid configuration"
+}
+
+// Check that value can be decoded into flag, without modifying the flag.
+func typeCheck(flag *kong.Flag, value interface{}) (err error) {
+	// A nil value is an explicitly unset key.
+	if value == nil {
+		return nil
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = errors.Errorf("%v", recovered)
+		}
+	}()
+	value, err = convertValue(flag, value)
+	if err != nil {
+		return err
+	}
+	target := reflect.New(flag.Target.Type()).Elem()
+	scan := kong.Scan().PushTyped(value, kong.FlagValueToken)
+	if err := flag.Mapper.Decode(&kong.DecodeContext{Value: flag.Value, Scan: scan}, target); err != nil {
+		return err
+	}
+	if flag.Enum == "" || target.Kind() == reflect.Slice || target.Kind() == reflect.Map {
+		return nil
+	}
+	if !flag.EnumMap()[fmt.Sprintf("%v", target)] {
+		enums := []string{}
+		for _, enum := range strings.Split(flag.Enum, ",") {
+			enums = append(enums, fmt.Sprintf("%q", strings.TrimSpace(enum)))
+		}
+		return errors.Errorf("must be one of %s but got %q", strings.Join(enums, ", "), target.Interface())
+	}
+	return nil
+}
+
+// Convert an error from loading or validating configuration into diagnostics.
+func errorDiagnostics(filename string, err error) []Diagnostic {
+	switch cause := errors.Cause(err).(type) {
+	case *Diagnostics:
+		return cause.Diagnostics
+	case *Error:
+		return []Diagnostic{{Rule: cause.Rule, Summary: summary(cause.Rule), Detail: sentence(cause.Message), Pos: cause.Pos}}
+	}
+	if filename != "" {
+		err = errors.Wrap(err, filename)
+	}
+	return []Diagnostic{{Summary: summary(""), Detail: sentence(err.Error())}}
+}
+
+// QuoteList quotes values and joins them with "or", as in suggestions for a mistyped key.
+func QuoteList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return strings.Join(quoted, " or ")
+}
+
+// Capitalise message and terminate it with a full stop.
+func sentence(message string) string {
+	if message == "" {
+		return message
+	}
+	return strings.ToUpper(message[:1]) + strings.TrimSuffix(message[1:], ".") + "."
+}
+
+// A reader with the name of the file it reads, from which loaders take the filename.
+type namedReader struct {
+	*bytes.Reader
+	name string
+}
+
+func (n *namedReader) Name() string { return n.name }
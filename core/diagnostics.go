@@ -0,0 +1,166 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Severity of a Diagnostic.
+type Severity int
+
+// Diagnostic severities.
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "Warning"
+	}
+	return "Error"
+}
+
+// A Diagnostic describes a problem in configuration source.
+type Diagnostic struct {
+	Severity Severity
+	// Rule identifying the kind of problem, if known, eg. RuleUnknownKey.
+	Rule    string
+	Summary string
+	Detail  string
+	// Pos is the start of the source the problem applies to, if known, and End the position after it.
+	Pos Position
+	End Position
+}
+
+// Diagnostics is an error consisting of one or more Diagnostic.
+//
+// When printed, each Diagnostic is rendered with a snippet of the source it applies to.
+type Diagnostics struct {
+	Diagnostics []Diagnostic
+	// Sources by filename, used to render snippets.
+	Sources map[string][]byte
+}
+
+// NewDiagnostics creates Diagnostics for a single source file.
+func NewDiagnostics(filename string, source []byte, diagnostics ...Diagnostic) *Diagnostics {
+	return &Diagnostics{Diagnostics: diagnostics, Sources: map[string][]byte{filename: source}}
+}
+
+// Error renders all diagnostics, without colour.
+//
+// Use Write to render them in colour, eg. d.Write(os.Stderr, IsTerminal(os.Stderr)), or
+// FatalIfErrorf to report an error containing them.
+func (d *Diagnostics) Error() string {
+	w := &strings.Builder{}
+	_ = d.Write(w, false)
+	return strings.TrimRight(w.String(), "\n")
+}
+
+// Write all diagnostics to w, optionally with ANSI colour.
+//
+// Each diagnostic is rendered with its severity and summary, a snippet of the source it applies to
+// with the problem underlined by carets, and its detail.
+func (d *Diagnostics) Write(w io.Writer, colour bool) error {
+	buf := &bytes.Buffer{}
+	for i, diag := range d.Diagnostics {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		highlight := func(s string) string {
+			if !colour {
+				return s
+			}
+			code := "1;31"
+			if diag.Severity == SeverityWarning {
+				code = "1;33"
+			}
+			return "\x1b[" + code + "m" + s + "\x1b[0m"
+		}
+		fmt.Fprintf(buf, "%s: %s\n", highlight(diag.Severity.String()), diag.Summary)
+		if diag.Pos.IsValid() {
+			if diag.Pos.Filename != "" {
+				fmt.Fprintf(buf, "\n  on %s line %d:\n", diag.Pos.Filename, diag.Pos.Line)
+			} else {
+				fmt.Fprintf(buf, "\n  on line %d:\n", diag.Pos.Line)
+			}
+			if line, ok := sourceLine(d.Sources[diag.Pos.Filename], diag.Pos.Line); ok {
+				prefix := fmt.Sprintf("  %4d: ", diag.Pos.Line)
+				fmt.Fprintf(buf, "%s%s\n", prefix, line)
+				fmt.Fprintf(buf, "%s%s%s\n", strings.Repeat(" ", len(prefix)), caretIndent(line, diag.Pos.Column), highlight(strings.Repeat("^", caretWidth(line, diag))))
+			}
+		}
+		if diag.Detail != "" {
+			fmt.Fprintf(buf, "\n%s\n", diag.Detail)
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// HasErrors returns true if there are any diagnostics with SeverityError.
+func (d *Diagnostics) HasErrors() bool {
+	for _, diag := range d.Diagnostics {
+		if diag.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the 1-based line "n" of source.
+func sourceLine(source []byte, n int) (string, bool) {
+	if source == nil {
+		return "", false
+	}
+	lines := strings.Split(string(source), "\n")
+	if n < 1 || n > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[n-1], "\r"), true
+}
+
+// Whitespace aligning with the 1-based column of line, preserving tabs.
+func caretIndent(line string, column int) string {
+	indent := &strings.Builder{}
+	for i, r := range []rune(line) {
+		if i >= column-1 {
+			break
+		}
+		if r == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+	return indent.String()
+}
+
+// The number of carets underlining diag on line, which is at least one.
+func caretWidth(line string, diag Diagnostic) int {
+	if !diag.End.IsValid() {
+		return 1
+	}
+	end := diag.End.Column
+	if diag.End.Line != diag.Pos.Line {
+		// Underline to the end of the first line.
+		end = len([]rune(line)) + 1
+	}
+	if width := end - diag.Pos.Column; width > 0 {
+		return width
+	}
+	return 1
+}
+
+// IsTerminal returns true if w is a terminal, and so may be written to in colour.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
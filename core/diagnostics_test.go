@@ -0,0 +1,131 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnosticsWrite(t *testing.T) {
+	source := []byte("db {\n\tdsn = 1\n}\n")
+	diags := NewDiagnostics("config.hcl", source,
+		Diagnostic{
+			Summary: "Incorrect type",
+			Detail:  "A string is required.",
+			Pos:     Position{Filename: "config.hcl", Line: 2, Column: 8},
+			End:     Position{Filename: "config.hcl", Line: 2, Column: 9},
+		},
+		Diagnostic{Severity: SeverityWarning, Summary: "Deprecated"},
+	)
+	w := &strings.Builder{}
+	require.NoError(t, diags.Write(w, false))
+	assert.Equal(t, "Error: Incorrect type\n"+
+		"\n"+
+		"  on config.hcl line 2:\n"+
+		"     2: \tdsn = 1\n"+
+		"        \t      ^\n"+
+		"\n"+
+		"A string is required.\n"+
+		"\n"+
+		"Warning: Deprecated\n", w.String())
+	assert.Equal(t, strings.TrimSuffix(w.String(), "\n"), diags.Error())
+	assert.True(t, diags.HasErrors())
+
+	w.Reset()
+	require.NoError(t, diags.Write(w, true))
+	assert.Contains(t, w.String(), "\x1b[1;31mError\x1b[0m: Incorrect type")
+	assert.Contains(t, w.String(), "\x1b[1;31m^\x1b[0m")
+	assert.Contains(t, w.String(), "\x1b[1;33mWarning\x1b[0m: Deprecated")
+}
+
+func TestFatalIfErrorf(t *testing.T) {
+	var cli struct{}
+	stderr := &strings.Builder{}
+	status := -1
+	app, err := kong.New(&cli, kong.Name("app"), kong.Writers(ioutil.Discard, stderr), kong.Exit(func(code int) { status = code }))
+	require.NoError(t, err)
+	diags := NewDiagnostics("config.hcl", nil, Diagnostic{Summary: "Invalid expression"})
+	err = errors.Wrap(diags, "--db-dsn")
+
+	FatalIfErrorf(app, nil)
+	assert.Equal(t, -1, status)
+
+	// Written plainly, as app.FatalIfErrorf does, unless stderr is a terminal.
+	FatalIfErrorf(app, err)
+	assert.Equal(t, 1, status)
+	assert.Equal(t, "app: error: --db-dsn: Error: Invalid expression\n", stderr.String())
+
+	stderr.Reset()
+	fatalIfErrorf(app, err, true, "loading %s", "config")
+	assert.Equal(t, "app: error: loading config: --db-dsn\n\x1b[1;31mError\x1b[0m: Invalid expression\n", stderr.String())
+
+	stderr.Reset()
+	fatalIfErrorf(app, errors.New("not diagnostics"), true)
+	assert.Equal(t, "app: error: not diagnostics\n", stderr.String())
+}
+
+func TestDiagnosticsWriteJSON(t *testing.T) {
+	diags := NewDiagnostics("config.hcl", nil,
+		Diagnostic{
+			Rule:    RuleUnknownKey,
+			Summary: "Unknown configuration key",
+			Detail:  `Unknown configuration key "unknown".`,
+			Pos:     Position{Filename: "config.hcl", Line: 3, Column: 1},
+		},
+		Diagnostic{Severity: SeverityWarning, Summary: "Deprecated"},
+	)
+	w := &strings.Builder{}
+	require.NoError(t, diags.WriteFormat(w, DiagnosticsJSON, false, "app"))
+	assert.Equal(t, `{"file":"config.hcl","range":{"start":{"line":3,"column":1},"end":{"line":3,"column":1}},"severity":"error","rule":"unknown-key","summary":"Unknown configuration key","message":"Unknown configuration key \"unknown\"."}`+"\n"+
+		`{"severity":"warning","rule":"invalid","summary":"Deprecated","message":"Deprecated"}`+"\n", w.String())
+}
+
+func TestDiagnosticsWriteSARIF(t *testing.T) {
+	diags := NewDiagnostics("config.hcl", nil,
+		Diagnostic{
+			Rule:    RuleTypeMismatch,
+			Summary: "Invalid configuration value",
+			Detail:  `Invalid value for "port".`,
+			Pos:     Position{Filename: "config.hcl", Line: 2, Column: 1},
+			End:     Position{Filename: "config.hcl", Line: 2, Column: 5},
+		},
+		Diagnostic{Severity: SeverityWarning, Rule: RuleDeprecated, Summary: "Deprecated configuration key"},
+	)
+	w := &strings.Builder{}
+	require.NoError(t, diags.WriteFormat(w, DiagnosticsSARIF, false, "app"))
+	var log map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(w.String()), &log))
+	assert.Equal(t, "2.1.0", log["version"])
+	run := log["runs"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"driver": map[string]interface{}{
+		"name": "app",
+		"rules": []interface{}{
+			map[string]interface{}{"id": "type-mismatch", "shortDescription": map[string]interface{}{"text": "Invalid configuration value"}},
+			map[string]interface{}{"id": "deprecated", "shortDescription": map[string]interface{}{"text": "Deprecated configuration key"}},
+		},
+	}}, run["tool"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"ruleId":  "type-mismatch",
+			"level":   "error",
+			"message": map[string]interface{}{"text": `Invalid value for "port".`},
+			"locations": []interface{}{map[string]interface{}{"physicalLocation": map[string]interface{}{
+				"artifactLocation": map[string]interface{}{"uri": "config.hcl"},
+				"region":           map[string]interface{}{"startLine": 2.0, "startColumn": 1.0, "endLine": 2.0, "endColumn": 5.0},
+			}}},
+		},
+		map[string]interface{}{
+			"ruleId":  "deprecated",
+			"level":   "warning",
+			"message": map[string]interface{}{"text": "Deprecated configuration key"},
+		},
+	}, run["results"])
+
+	require.Error(t, diags.WriteFormat(w, "xml", false, "app"))
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The number of unchanged lines shown around each change by UnifiedDiff.
+const diffContext = 3
+
+// UnifiedDiff returns the changes from a to b, the contents of the file "name" before and after,
+// as a unified diff. The diff is empty if a and b are the same.
+func UnifiedDiff(name string, a, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+	from, to := splitLines(string(a)), splitLines(string(b))
+	ops := diffLines(from, to)
+	w := &strings.Builder{}
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", name, name)
+	for start := 0; start < len(ops); {
+		// Find the next change, and the extent of the hunk around it.
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		begin := maxInt(start-diffContext, 0)
+		end := start
+		for unchanged := 0; end < len(ops) && unchanged <= 2*diffContext; end++ {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		// Trim trailing context beyond diffContext lines.
+		for end > begin && ops[end-1].kind == ' ' && trailingContext(ops[begin:end]) > diffContext {
+			end--
+		}
+		hunk := ops[begin:end]
+		fromLines, toLines := 0, 0
+		for _, op := range hunk {
+			if op.kind != '+' {
+				fromLines++
+			}
+			if op.kind != '-' {
+				toLines++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(hunk[0].from, fromLines), hunkRange(hunk[0].to, toLines))
+		for _, op := range hunk {
+			fmt.Fprintf(w, "%c%s\n", op.kind, op.line)
+		}
+		start = end
+	}
+	return w.String()
+}
+
+// A line in a diff, and its 0-based index in the old and new files.
+type diffOp struct {
+	kind     byte
+	line     string
+	from, to int
+}
+
+// Diff lines with a longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = maxInt(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	ops := []diffOp{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{kind: ' ', line: a[i], from: i, to: j})
+			i++
+			j++
+		// Deletions are written before insertions.
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{kind: '-', line: a[i], from: i, to: j})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', line: b[j], from: i, to: j})
+			j++
+		}
+	}
+	return ops
+}
+
+func trailingContext(ops []diffOp) int {
+	n := 0
+	for i := len(ops) - 1; i >= 0 && ops[i].kind == ' '; i-- {
+		n++
+	}
+	return n
+}
+
+// Format the range of a hunk starting at the 0-based line start.
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if lines == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, lines)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+	assert.Equal(t, `--- config.hcl
++++ config.hcl
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -11,3 +11,4 @@
+ k
+ l
+ m
++n
+`, UnifiedDiff("config.hcl", []byte(before), []byte(after)))
+	assert.Equal(t, "", UnifiedDiff("config.hcl", []byte(before), []byte(before)))
+	assert.Equal(t, "--- config.hcl\n+++ config.hcl\n@@ -0,0 +1 @@\n+a\n", UnifiedDiff("config.hcl", nil, []byte("a\n")))
+}
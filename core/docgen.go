@@ -0,0 +1,264 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+var byteSizeType = reflect.TypeOf(ByteSize(0))
+
+// A Reference documents the configuration keys of an Application.
+type Reference struct {
+	Keys []ReferenceKey
+}
+
+// A ReferenceKey documents a configuration key.
+type ReferenceKey struct {
+	// Key is the flat form of the key, eg. "db-dsn", in the configured KeyStyle.
+	Key string
+	// Block and Name are the block form of the key, eg. "db" and "dsn" for "db { dsn = ... }".
+	// Block is empty if the key has no block form.
+	Block, Name string
+	// Type of the value, eg. "string", "number", "duration" or "list(string)".
+	Type    string
+	Default string
+	Enum    []string
+	Env     string
+	Help    string
+	// Command the key applies to, eg. "server start", or empty if it applies to the application.
+	Command string
+	// Deprecated is the deprecation note of the flag, if it is deprecated.
+	Deprecated string
+	// Replaces are the deprecated keys registered with DeprecatedKey that are renamed to Key.
+	Replaces []string
+}
+
+// DocGen documents the configuration keys of every flag in app, except hidden flags and those
+// in ignore, as interpreted by a Resolver with options.
+func DocGen(app *kong.Application, ignore map[string]bool, options ...Option) *Reference {
+	r := newResolver(NewTree(map[string]interface{}{}), options)
+	replaces := map[string][]string{}
+	for _, key := range sortedRenames(r.renamed) {
+		replaces[r.renamed[key]] = append(replaces[r.renamed[key]], r.style.Format(key))
+	}
+	ref := &Reference{}
+	var walk func(node *kong.Node, path []string)
+	walk = func(node *kong.Node, path []string) {
+		for _, flag := range node.Flags {
+			if flag.Hidden || ignore[flag.Name] {
+				continue
+			}
+			key := r.normaliseKey(strings.Join(append(append([]string{}, path...), flag.Name), "-"))
+			doc := ReferenceKey{
+				Key:      r.style.Format(key),
+				Type:     typeName(flag),
+				Default:  flag.Default,
+				Env:      flag.Env,
+				Help:     flag.Help,
+				Command:  strings.Join(path, " "),
+				Replaces: replaces[key],
+			}
+			if flag.Group != nil && flag.Group.Key != "" && len(path) == 0 {
+				doc.Block, doc.Name = r.style.Format(flag.Group.Key), r.style.Format(flag.Name)
+			} else if parts := strings.SplitN(key, "-", 2); len(parts) == 2 {
+				doc.Block, doc.Name = r.style.Format(parts[0]), r.style.Format(parts[1])
+			}
+			if flag.Enum != "" {
+				for _, value := range strings.Split(flag.Enum, ",") {
+					doc.Enum = append(doc.Enum, strings.TrimSpace(value))
+				}
+			}
+			if flag.Tag.Has("deprecated") {
+				doc.Deprecated = flag.Tag.Get("deprecated")
+			}
+			ref.Keys = append(ref.Keys, doc)
+		}
+		for _, child := range node.Children {
+			walk(child, append(append([]string{}, path...), child.Name))
+		}
+	}
+	walk(app.Node, nil)
+	sort.SliceStable(ref.Keys, func(i, j int) bool { return ref.Keys[i].Key < ref.Keys[j].Key })
+	return ref
+}
+
+// The configuration type of the value of a flag.
+func typeName(flag *kong.Flag) string {
+	if flag.Tag.Type == "bytesize" {
+		return "byte size"
+	}
+	return configType(flag.Target.Type(), flag.Tag.Type != "")
+}
+
+func configType(t reflect.Type, mapped bool) string {
+	switch {
+	case t == byteSizeType:
+		return "byte size"
+	case t == durationType:
+		return "duration"
+	case !mapped && reflect.PtrTo(t).Implements(mapperValueType):
+		return "object"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "list(" + configType(t.Elem(), mapped) + ")"
+	case reflect.Map:
+		return "map(" + configType(t.Elem(), mapped) + ")"
+	default:
+		return t.String()
+	}
+}
+
+// Markdown renders the reference as Markdown, with a section for each key.
+func (ref *Reference) Markdown() string {
+	w := &strings.Builder{}
+	w.WriteString("## Configuration\n")
+	if intro := ref.intro(func(s string) string { return "`" + s + "`" }); intro != "" {
+		fmt.Fprintf(w, "\n%s\n", intro)
+	}
+	for _, key := range ref.Keys {
+		fmt.Fprintf(w, "\n### `%s`\n\n", key.Key)
+		if key.Help != "" {
+			fmt.Fprintf(w, "%s\n\n", key.Help)
+		}
+		if key.Block != "" {
+			fmt.Fprintf(w, "- Block form: `%s { %s = ... }`\n", key.Block, key.Name)
+		}
+		fmt.Fprintf(w, "- Type: `%s`\n", key.Type)
+		if key.Default != "" {
+			fmt.Fprintf(w, "- Default: `%s`\n", key.Default)
+		}
+		if len(key.Enum) > 0 {
+			fmt.Fprintf(w, "- Values: %s\n", codeList(key.Enum))
+		}
+		if key.Env != "" {
+			fmt.Fprintf(w, "- Environment variable: `%s`\n", key.Env)
+		}
+		if key.Command != "" {
+			fmt.Fprintf(w, "- Command: `%s`\n", key.Command)
+		}
+		if key.Deprecated != "" {
+			fmt.Fprintf(w, "- Deprecated: %s\n", sentence(key.Deprecated))
+		}
+		if len(key.Replaces) > 0 {
+			fmt.Fprintf(w, "- Replaces the deprecated %s %s.\n", plural("key", len(key.Replaces)), codeList(key.Replaces))
+		}
+	}
+	return w.String()
+}
+
+// Roff renders the reference as a CONFIGURATION section of a man page, preceded by a FILES
+// section listing paths if any are given.
+func (ref *Reference) Roff(paths ...string) string {
+	w := &strings.Builder{}
+	if len(paths) > 0 {
+		w.WriteString(".SH FILES\n")
+		for _, path := range paths {
+			fmt.Fprintf(w, ".TP\n.I %s\nConfiguration file, in HCL.\n", roffEscape(path))
+		}
+	}
+	w.WriteString(".SH CONFIGURATION\n")
+	if intro := ref.intro(func(s string) string { return `\fB` + roffEscape(s) + `\fR` }); intro != "" {
+		fmt.Fprintf(w, "%s\n", intro)
+	}
+	for _, key := range ref.Keys {
+		w.WriteString(".TP\n")
+		fmt.Fprintf(w, "\\fB%s\\fR", roffEscape(key.Key))
+		if key.Block != "" {
+			fmt.Fprintf(w, ", \\fB%s { %s }\\fR", roffEscape(key.Block), roffEscape(key.Name))
+		}
+		fmt.Fprintf(w, " (\\fI%s\\fR)\n", roffEscape(key.Type))
+		if key.Help != "" {
+			fmt.Fprintf(w, "%s\n", roffLine(key.Help))
+		}
+		details := []string{}
+		if key.Default != "" {
+			details = append(details, "Default: "+key.Default+".")
+		}
+		if len(key.Enum) > 0 {
+			details = append(details, "Values: "+strings.Join(key.Enum, ", ")+".")
+		}
+		if key.Env != "" {
+			details = append(details, "Environment variable: "+key.Env+".")
+		}
+		if key.Command != "" {
+			details = append(details, "Command: "+key.Command+".")
+		}
+		if key.Deprecated != "" {
+			details = append(details, "Deprecated: "+sentence(key.Deprecated))
+		}
+		if len(key.Replaces) > 0 {
+			details = append(details, fmt.Sprintf("Replaces the deprecated %s %s.", plural("key", len(key.Replaces)), strings.Join(key.Replaces, ", ")))
+		}
+		if len(details) > 0 {
+			if key.Help != "" {
+				w.WriteString(".br\n")
+			}
+			fmt.Fprintf(w, "%s\n", roffLine(strings.Join(details, " ")))
+		}
+	}
+	return w.String()
+}
+
+// Introduce the keys of the reference, taking an example of the block form from them, with
+// code formatting keys.
+func (ref *Reference) intro(code func(string) string) string {
+	sentences := []string{}
+	for _, key := range ref.Keys {
+		if key.Block != "" {
+			sentences = append(sentences, fmt.Sprintf("Keys may be written flat, eg. %s, or inside a block, eg. %s.",
+				code(key.Key+" = ..."), code(key.Block+" { "+key.Name+" = ... }")))
+			break
+		}
+	}
+	for _, key := range ref.Keys {
+		if key.Command != "" {
+			sentences = append(sentences, "Keys of a command apply only when it is run.")
+			break
+		}
+	}
+	return strings.Join(sentences, " ")
+}
+
+func codeList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = "`" + value + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func plural(noun string, n int) string {
+	if n == 1 {
+		return noun
+	}
+	return noun + "s"
+}
+
+// Escape text for roff.
+func roffEscape(s string) string {
+	return strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+}
+
+// Escape a line of text for roff, such that it is not read as a request.
+func roffLine(s string) string {
+	lines := strings.Split(roffEscape(s), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
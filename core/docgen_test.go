@@ -0,0 +1,90 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocGen(t *testing.T) {
+	var cli struct {
+		LogLevel string        `help:"Log level." enum:"debug,info" default:"info" env:"LOG_LEVEL"`
+		Timeout  time.Duration `help:"Request timeout." deprecated:"use server-timeout"`
+		Secret   string        `hidden:""`
+		DB       struct {
+			DSN      string
+			MaxConns int            `help:"Maximum connections."`
+			Limits   map[string]int `help:"Per-table row limits."`
+		} `embed:"" prefix:"db-"`
+		Server struct {
+			Hosts   []string `help:"Hosts to listen on."`
+			MaxBody ByteSize `help:"Largest request body."`
+		} `cmd:""`
+	}
+	parser, err := kong.New(&cli)
+	require.NoError(t, err)
+
+	ref := DocGen(parser.Model, map[string]bool{"help": true}, DeprecatedKey("dsn", "db-dsn"), NormaliseKeys(SnakeCase))
+	require.Equal(t, []ReferenceKey{
+		{Key: "db_dsn", Block: "db", Name: "dsn", Type: "string", Replaces: []string{"dsn"}},
+		{Key: "db_limits", Block: "db", Name: "limits", Type: "map(number)", Help: "Per-table row limits."},
+		{Key: "db_max_conns", Block: "db", Name: "max_conns", Type: "number", Help: "Maximum connections."},
+		{Key: "log_level", Block: "log", Name: "level", Type: "string", Default: "info", Enum: []string{"debug", "info"}, Env: "LOG_LEVEL", Help: "Log level."},
+		{Key: "server_hosts", Block: "server", Name: "hosts", Type: "list(string)", Help: "Hosts to listen on.", Command: "server"},
+		{Key: "server_max_body", Block: "server", Name: "max_body", Type: "byte size", Help: "Largest request body.", Command: "server"},
+		{Key: "timeout", Type: "duration", Help: "Request timeout.", Deprecated: "use server-timeout"},
+	}, ref.Keys)
+
+	ref.Keys = ref.Keys[3:4]
+	ref.Keys = append(ref.Keys, ReferenceKey{Key: "timeout", Type: "duration", Help: "Request timeout.", Deprecated: "use server-timeout", Replaces: []string{"wait"}})
+	require.Equal(t, "## Configuration\n\n"+
+		"Keys may be written flat, eg. `log_level = ...`, or inside a block, eg. `log { level = ... }`.\n"+
+		"\n"+
+		"### `log_level`\n"+
+		"\n"+
+		"Log level.\n"+
+		"\n"+
+		"- Block form: `log { level = ... }`\n"+
+		"- Type: `string`\n"+
+		"- Default: `info`\n"+
+		"- Values: `debug`, `info`\n"+
+		"- Environment variable: `LOG_LEVEL`\n"+
+		"\n"+
+		"### `timeout`\n"+
+		"\n"+
+		"Request timeout.\n"+
+		"\n"+
+		"- Type: `duration`\n"+
+		"- Deprecated: Use server-timeout.\n"+
+		"- Replaces the deprecated key `wait`.\n", ref.Markdown())
+
+	// Without keys in block form or of commands, there is nothing to introduce.
+	require.Equal(t, "## Configuration\n\n### `timeout`\n\n- Type: `duration`\n", (&Reference{Keys: []ReferenceKey{{Key: "timeout", Type: "duration"}}}).Markdown())
+
+	ref.Keys = append(ref.Keys, ReferenceKey{Key: "server_hosts", Block: "server", Name: "hosts", Type: "list(string)", Help: ".Hosts to\nlisten on.", Command: "server"})
+	require.Equal(t, ".SH FILES\n"+
+		".TP\n"+
+		".I /etc/my\\-app.hcl\n"+
+		"Configuration file, in HCL.\n"+
+		".SH CONFIGURATION\n"+
+		"Keys may be written flat, eg. \\fBlog_level = ...\\fR, or inside a block, eg. \\fBlog { level = ... }\\fR. "+
+		"Keys of a command apply only when it is run.\n"+
+		".TP\n"+
+		"\\fBlog_level\\fR, \\fBlog { level }\\fR (\\fIstring\\fR)\n"+
+		"Log level.\n"+
+		".br\n"+
+		"Default: info. Values: debug, info. Environment variable: LOG_LEVEL.\n"+
+		".TP\n"+
+		"\\fBtimeout\\fR (\\fIduration\\fR)\n"+
+		"Request timeout.\n"+
+		".br\n"+
+		"Deprecated: Use server\\-timeout. Replaces the deprecated key wait.\n"+
+		".TP\n"+
+		"\\fBserver_hosts\\fR, \\fBserver { hosts }\\fR (\\fIlist(string)\\fR)\n"+
+		"\\&.Hosts to\n"+
+		"listen on.\n"+
+		".br\n"+
+		"Command: server.\n", ref.Roff("/etc/my-app.hcl"))
+}
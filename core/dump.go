@@ -0,0 +1,118 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// The kong variable in which Configuration records the KeyStyle of its loader.
+const keyStyleVar = "konghcl_key_style"
+
+// Record the KeyStyle of the Resolvers created by loader in the variables of an application.
+func recordKeyStyle(loader kong.ConfigurationLoader) kong.Vars {
+	style := KebabCase
+	if resolver, err := loader(strings.NewReader("")); err == nil {
+		if r, ok := resolver.(*Resolver); ok {
+			style = r.style
+		}
+	}
+	return kong.Vars{keyStyleVar: strconv.Itoa(int(style))}
+}
+
+// ConfiguredKeyStyle returns the KeyStyle of the loader passed to Configuration, as recorded in
+// the variables of an application, or KebabCase if there is none.
+//
+// Hooks are passed the variables of the application as a kong.Vars parameter.
+func ConfiguredKeyStyle(vars kong.Vars) KeyStyle {
+	style, err := strconv.Atoi(vars[keyStyleVar])
+	if err != nil {
+		return KebabCase
+	}
+	return KeyStyle(style)
+}
+
+// Dump writes an example HCL configuration for all flags in app, except those in ignore.
+//
+// Keys are written in the given style.
+func Dump(app *kong.Kong, ignore map[string]bool, style KeyStyle) {
+	groups := map[string][]*kong.Flag{}
+	standalone := []*kong.Flag{}
+	for _, flags := range app.Model.AllFlags(true) {
+		for _, flag := range flags {
+			if ignore[flag.Name] {
+				continue
+			}
+			parts := strings.SplitN(flag.Name, "-", 2)
+			if len(parts) == 1 {
+				standalone = append(standalone, flag)
+			} else {
+				groups[parts[0]] = append(groups[parts[0]], flag)
+			}
+		}
+	}
+
+	// Write non-grouped flags out at the top.
+	for key, flags := range groups {
+		if len(flags) == 1 {
+			standalone = append(standalone, flags...)
+			delete(groups, key)
+		}
+	}
+
+	// Alphabetical ordering.
+	sort.Slice(standalone, func(i, j int) bool {
+		return standalone[i].Name < standalone[j].Name
+	})
+	for _, flag := range standalone {
+		formatFlag("", flag, false, style)
+		fmt.Println()
+	}
+	delete(groups, "")
+
+	// Alphabetically order the groups.
+	keys := []string{}
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, block := range keys {
+		flags := groups[block]
+		if len(flags) == 1 {
+			formatFlag("", flags[0], false, style)
+			fmt.Println()
+			continue
+		}
+		fmt.Printf("%s {\n", style.Format(block))
+		for i, flag := range flags {
+			if i != 0 {
+				fmt.Println()
+			}
+			formatFlag("  ", flag, true, style)
+		}
+		fmt.Printf("}\n\n")
+	}
+}
+
+func formatFlag(indent string, flag *kong.Flag, grouped bool, style KeyStyle) {
+	fmt.Printf("%s// %s\n", indent, flag.Help)
+	fmt.Print(indent)
+	if grouped {
+		parts := strings.SplitN(flag.Name, "-", 2)
+		fmt.Printf("%s = ", style.Format(parts[1]))
+	} else {
+		fmt.Printf("%s = ", style.Format(flag.Name))
+	}
+	switch {
+	case flag.IsSlice():
+		fmt.Println("[ ... ]")
+	case flag.IsMap():
+		fmt.Println("{ ... }")
+	default:
+		fmt.Println(flag.FormatPlaceHolder())
+	}
+}
@@ -0,0 +1,9 @@
+module github.com/alecthomas/kong-hcl/core
+
+go 1.14
+
+require (
+	github.com/alecthomas/kong v0.2.16
+	github.com/pkg/errors v0.8.1
+	github.com/stretchr/testify v1.2.2
+)
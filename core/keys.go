@@ -0,0 +1,148 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// AllowKeys permits configuration keys that do not correspond to any flag.
+//
+// Each key also permits all keys below it, so an application can keep its own configuration
+// alongside that of its flags and read it with Resolver.Get or Resolver.Section:
+//
+//	loader := konghcl.NewLoader(konghcl.AllowKeys("plugins"))
+func AllowKeys(keys ...string) Option {
+	return func(r *Resolver) {
+		r.allowed = append(r.allowed, keys...)
+	}
+}
+
+// Keys returns the sorted keys of all values in the configuration.
+//
+// Keys are hyphen-separated, or underscore-separated if NormaliseKeys(SnakeCase) is used.
+//
+// Keys inside profiles are not included.
+func (r *Resolver) Keys() []string {
+	paths, _ := flattenNode(r.config)
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, path := range paths {
+		key := r.style.Format(r.normaliseKey(strings.Join(path, "-")))
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Get the value at path, with the same lookup rules used to resolve flags.
+//
+// That is, Get("db", "dsn") will find both "db-dsn" and "dsn" inside a "db" block. Blocks are
+// returned as map[string]interface{} or []map[string]interface{}. Profiles are not considered.
+func (r *Resolver) Get(path ...string) (interface{}, bool) {
+	value, err := r.find(r.config, r.root, r.normalisePath(path))
+	if err != nil || value == nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Section returns a Resolver for the configuration below the key "name".
+//
+// The section includes keys prefixed with "name-" as well as those inside blocks named "name",
+// such that section.Get("dsn") is equivalent to Get("name", "dsn"). If there is no such
+// configuration the section is empty.
+func (r *Resolver) Section(name string) *Resolver {
+	name = r.normaliseKey(name)
+	section := &Resolver{
+		tree:      r.tree,
+		config:    r.sectionOf(r.config, strings.Split(name, "-")),
+		profiles:  map[string]map[string]interface{}{},
+		allowed:   r.allowed,
+		mode:      r.mode,
+		warn:      r.warn,
+		renamed:   r.renamed,
+		normalise: r.normalise,
+		style:     r.style,
+	}
+	// Positions can only be reported if the section is a single block in the tree.
+	key, _ := r.keyIn(r.config, r.root, name)
+	if blocks, ok := asBlocks(r.config[key]); ok && len(blocks) == 1 && len(section.config) == len(blocks[0]) {
+		section.root = append(append([]string{}, r.root...), key)
+	} else {
+		section.tree = NewTree(section.config)
+	}
+	return section
+}
+
+// Unused returns the sorted keys in the configuration, including those in profiles, that do not
+// configure any flag in app and are not permitted by AllowKeys.
+//
+// Keys in profiles are prefixed with "profile-<name>-", in the configured KeyStyle.
+func (r *Resolver) Unused(app *kong.Application) []string {
+	schema := r.schema(app)
+	unused := r.unknownKeys(schema, r.config, "")
+	for _, name := range r.profileNames() {
+		unused = append(unused, r.unknownKeys(schema, r.profiles[name], r.style.Format(fmt.Sprintf("%s-%s-", profileBlock, name)))...)
+	}
+	return unused
+}
+
+func (r *Resolver) unknownKeys(schema *schema, config map[string]interface{}, prefix string) []string {
+	keys, _ := r.flattenConfig(schema, nil, config)
+	unknown := []string{}
+	for _, key := range sortedKeys(keys) {
+		if r.isUnknown(schema, key) {
+			unknown = append(unknown, prefix+r.style.Format(key))
+		}
+	}
+	return unknown
+}
+
+// Collect the configuration below the hyphen-separated key "parts" into a single block, whose
+// keys are in canonical form.
+//
+// Precedence matches find: flat keys override blocks, and longer block prefixes override shorter.
+func (r *Resolver) sectionOf(config map[string]interface{}, parts []string) map[string]interface{} {
+	out := map[string]interface{}{}
+	for i := 1; i < len(parts); i++ {
+		value, _ := r.lookup(config, nil, strings.Join(parts[:i], "-"))
+		blocks, _ := asBlocks(value)
+		for _, block := range blocks {
+			r.mergeSection(out, r.sectionOf(block, parts[i:]))
+		}
+	}
+	key := strings.Join(parts, "-")
+	value, _ := r.lookup(config, nil, key)
+	blocks, _ := asBlocks(value)
+	for _, block := range blocks {
+		r.mergeSection(out, block)
+	}
+	flat := map[string]interface{}{}
+	for k, value := range config {
+		if k = r.normaliseKey(k); strings.HasPrefix(k, key+"-") {
+			flat[strings.TrimPrefix(k, key+"-")] = value
+		}
+	}
+	r.mergeSection(out, flat)
+	return out
+}
+
+// Merge src into dst, concatenating blocks with the same key so that later blocks take precedence.
+func (r *Resolver) mergeSection(dst, src map[string]interface{}) {
+	for key, value := range src {
+		key = r.normaliseKey(key)
+		existing, ok := asBlocks(dst[key])
+		blocks, isBlock := asBlocks(value)
+		if ok && isBlock {
+			dst[key] = append(append([]map[string]interface{}{}, existing...), blocks...)
+		} else if value != nil || dst[key] == nil {
+			dst[key] = value
+		}
+	}
+}
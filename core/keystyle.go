@@ -0,0 +1,125 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KeyStyle is the style in which multi-word configuration keys are written.
+type KeyStyle int
+
+// Key styles.
+const (
+	// KebabCase keys are separated with hyphens, eg. "max-conns", matching kong flag names.
+	KebabCase KeyStyle = iota
+	// SnakeCase keys are separated with underscores, eg. "max_conns", as is idiomatic in HCL.
+	SnakeCase
+)
+
+// Format a hyphen-separated key in this style.
+func (s KeyStyle) Format(key string) string {
+	if s == SnakeCase {
+		return strings.Replace(key, "-", "_", -1)
+	}
+	return key
+}
+
+// NormaliseKeys accepts configuration keys separated with either hyphens or underscores.
+//
+// With this option "db_dsn", "db-dsn" and "dsn" inside a "db" block all configure the flag
+// "--db-dsn". Keys are reported in the given style, and setting both spellings of the same key in
+// one block is an error.
+func NormaliseKeys(style KeyStyle) Option {
+	return func(r *Resolver) {
+		r.normalise = true
+		r.style = style
+	}
+}
+
+// Convert a key to its canonical, hyphen-separated form.
+func (r *Resolver) normaliseKey(key string) string {
+	if !r.normalise {
+		return key
+	}
+	return strings.Replace(key, "_", "-", -1)
+}
+
+func (r *Resolver) normalisePath(path []string) []string {
+	if !r.normalise {
+		return path
+	}
+	out := make([]string, len(path))
+	for i, key := range path {
+		out[i] = r.normaliseKey(key)
+	}
+	return out
+}
+
+func (r *Resolver) normalisePaths(paths [][]string) [][]string {
+	for i, path := range paths {
+		paths[i] = r.normalisePath(path)
+	}
+	return paths
+}
+
+// Normalise the keys passed to options.
+//
+// Keys in the configuration are normalised as they are looked up, as only then is it known
+// which of them configure flags, below which keys are values that must be kept as written.
+func (r *Resolver) normaliseConfig() {
+	if !r.normalise {
+		return
+	}
+	renamed := make(map[string]string, len(r.renamed))
+	for key, replacement := range r.renamed {
+		renamed[r.normaliseKey(key)] = r.normaliseKey(replacement)
+	}
+	r.renamed = renamed
+	for i, key := range r.allowed {
+		r.allowed[i] = r.normaliseKey(key)
+	}
+}
+
+// Returns the key in config, which is located at "root" in the Tree, that is spelled "key" in
+// canonical form, or "" if there is none.
+//
+// An error is returned if config contains more than one spelling of key.
+func (r *Resolver) keyIn(config map[string]interface{}, root []string, key string) (string, error) {
+	if !r.normalise {
+		if _, ok := config[key]; ok {
+			return key, nil
+		}
+		return "", nil
+	}
+	found := ""
+	for _, k := range sortedConfigKeys(config) {
+		if r.normaliseKey(k) != key {
+			continue
+		}
+		if found != "" {
+			pos, _ := r.tree.Position(append(append([]string{}, root...), k))
+			return "", &Error{Pos: pos, Rule: RuleConflict, Message: fmt.Sprintf("configuration keys %q and %q conflict", found, k)}
+		}
+		found = k
+	}
+	return found, nil
+}
+
+// Look up the value of the canonical key in config, which is located at "root" in the Tree.
+func (r *Resolver) lookup(config map[string]interface{}, root []string, key string) (interface{}, error) {
+	k, err := r.keyIn(config, root, key)
+	if err != nil || k == "" {
+		return nil, err
+	}
+	return config[k], nil
+}
+
+func sortedConfigKeys(config map[string]interface{}) []string {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
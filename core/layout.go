@@ -0,0 +1,102 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// KeyKind classifies a configuration key by what it configures.
+type KeyKind int
+
+// Kinds of configuration key.
+const (
+	// KeyUnknown does not configure any flag.
+	KeyUnknown KeyKind = iota
+	// KeyFlag configures a flag, and its value is the whole value of the flag.
+	KeyFlag
+	// KeyPrefix is a prefix of the keys of one or more flags, and may be a block containing them.
+	KeyPrefix
+)
+
+// A Layout arranges the configuration keys of an Application canonically.
+//
+// Keys are grouped as by Dump: a key that shares its first hyphen-separated segment with any
+// other key is written inside a block named after that segment, while other keys are written
+// flat, in the configured KeyStyle.
+type Layout struct {
+	r      *Resolver
+	schema *schema
+	groups map[string]int
+}
+
+// NewLayout creates a Layout for app, with keys interpreted as by a Resolver with options.
+func NewLayout(app *kong.Application, options ...Option) *Layout {
+	return newResolver(NewTree(map[string]interface{}{}), options).Layout(app)
+}
+
+// Layout returns the Layout of keys for app, interpreted as by this Resolver.
+func (r *Resolver) Layout(app *kong.Application) *Layout {
+	return r.layout(r.schema(app))
+}
+
+func (r *Resolver) layout(schema *schema) *Layout {
+	l := &Layout{r: r, schema: schema, groups: map[string]int{}}
+	for key := range l.schema.valid {
+		if _, ok := r.renamed[key]; ok {
+			continue
+		}
+		if parts := strings.SplitN(key, "-", 2); len(parts) == 2 {
+			l.groups[parts[0]]++
+		}
+	}
+	return l
+}
+
+// Classify the key at path, returning the canonical key and its kind.
+//
+// Deprecated keys are replaced by the keys they were renamed to with DeprecatedKey, and keys
+// configuring flags with a MapperValue are of kind KeyFlag.
+func (l *Layout) Classify(path []string) (string, KeyKind) {
+	key := l.r.normaliseKey(strings.Join(path, "-"))
+	if replacement, ok := l.r.renamed[key]; ok {
+		key = replacement
+	}
+	if l.schema.valid[key] {
+		return key, KeyFlag
+	}
+	for _, prefix := range l.schema.rawPrefixes {
+		if key == prefix {
+			return key, KeyFlag
+		}
+	}
+	for valid := range l.schema.valid {
+		if strings.HasPrefix(valid, key+"-") {
+			return key, KeyPrefix
+		}
+	}
+	for _, prefix := range l.schema.rawPrefixes {
+		if strings.HasPrefix(prefix, key+"-") {
+			return key, KeyPrefix
+		}
+	}
+	return key, KeyUnknown
+}
+
+// Place returns the block that key is written in, or "" if it is written flat, and the name it is
+// written with there, both in the configured KeyStyle.
+func (l *Layout) Place(key string) (block string, name string) {
+	parts := strings.SplitN(key, "-", 2)
+	if len(parts) == 2 && l.groups[parts[0]] > 1 {
+		return l.r.style.Format(parts[0]), l.r.style.Format(parts[1])
+	}
+	return "", l.r.style.Format(key)
+}
+
+// ProfileBlock returns the type of the blocks declaring profiles, or "" if profiles are disabled.
+func (l *Layout) ProfileBlock() string {
+	if l.r.profileFlag == "" {
+		return ""
+	}
+	return profileBlock
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/alecthomas/kong"
+)
+
+// The block type used to declare named configuration profiles.
+const profileBlock = "profile"
+
+// ProfileFlag enables named configuration profiles, selected by the value of the given flag.
+//
+// Profiles are declared with labelled blocks and are overlaid on top of the base configuration
+// when selected, either on the command-line or through the environment variable of the flag:
+//
+//	var cli struct {
+//	  Profile string `help:"Configuration profile." env:"APP_PROFILE"`
+//	}
+//
+//	loader := konghcl.NewLoader(konghcl.ProfileFlag("profile"))
+//	parser, err := kong.New(&cli, kong.Configuration(loader, "~/.myapp.hcl"))
+//
+// With the following configuration, "--profile=staging" would resolve "db-dsn" to "staging@/database":
+//
+//	db {
+//	  dsn = "root@/database"
+//	}
+//
+//	profile "staging" {
+//	  db {
+//	    dsn = "staging@/database"
+//	  }
+//	}
+func ProfileFlag(flag string) Option {
+	return func(r *Resolver) {
+		r.profileFlag = flag
+	}
+}
+
+// Move profile blocks out of the base configuration.
+func (r *Resolver) extractProfiles() error {
+	r.profiles = map[string]map[string]interface{}{}
+	if r.profileFlag == "" {
+		return nil
+	}
+	raw, ok := r.config[profileBlock]
+	if !ok {
+		return nil
+	}
+	config := make(map[string]interface{}, len(r.config))
+	for key, value := range r.config {
+		if key != profileBlock {
+			config[key] = value
+		}
+	}
+	r.config = config
+	blocks, ok := asBlocks(raw)
+	if !ok {
+		pos, _ := r.tree.Position([]string{profileBlock})
+		return &Error{Pos: pos, Message: fmt.Sprintf("expected %q to be a block", profileBlock)}
+	}
+	for _, block := range blocks {
+		for name, body := range block {
+			bodies, ok := asBlocks(body)
+			if !ok {
+				pos, _ := r.tree.Position([]string{profileBlock, name})
+				return &Error{Pos: pos, Message: fmt.Sprintf("expected profile %q to be a block", name)}
+			}
+			profile := r.profiles[name]
+			if profile == nil {
+				profile = map[string]interface{}{}
+				r.profiles[name] = profile
+			}
+			// Later blocks for the same profile override earlier ones.
+			for _, body := range bodies {
+				for key, value := range body {
+					profile[key] = value
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Resolver) profileNames() []string {
+	names := []string{}
+	for name := range r.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the profile selected in the current context, if any.
+func activeProfile(context *kong.Context, profileFlag string) string {
+	if context == nil || profileFlag == "" {
+		return ""
+	}
+	for _, flag := range context.Flags() {
+		if flag.Name == profileFlag {
+			profile, _ := context.FlagValue(flag).(string)
+			return profile
+		}
+	}
+	return ""
+}
+
+// Returns the profile selected in an Application that has had its values applied, if any.
+func selectedProfile(app *kong.Application, profileFlag string) string {
+	if profileFlag == "" {
+		return ""
+	}
+	profile := ""
+	_ = kong.Visit(app, func(node kong.Visitable, next kong.Next) error {
+		if flag, ok := node.(*kong.Flag); ok && flag.Name == profileFlag {
+			profile, _ = flag.Target.Interface().(string)
+			return nil
+		}
+		return next(nil)
+	})
+	return profile
+}
@@ -0,0 +1,249 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/pkg/errors"
+)
+
+// DiagnosticsFormat is a format that Diagnostics can be written in.
+type DiagnosticsFormat string
+
+// Diagnostics formats.
+const (
+	// DiagnosticsText is the human-readable format written by Diagnostics.Write.
+	DiagnosticsText DiagnosticsFormat = "text"
+	// DiagnosticsJSON writes each diagnostic as a JSON object on its own line.
+	DiagnosticsJSON DiagnosticsFormat = "json"
+	// DiagnosticsSARIF writes a SARIF 2.1.0 log, as consumed by code scanning tools.
+	DiagnosticsSARIF DiagnosticsFormat = "sarif"
+)
+
+// RuleInvalid identifies problems that are not covered by a more specific rule, such as syntax
+// errors, in machine-readable output.
+const RuleInvalid = "invalid"
+
+// DiagnosticsOf converts an error returned by a Loader, Resolver.Validate or DecodeValue into
+// Diagnostics, so that it may be written in any DiagnosticsFormat.
+//
+// Errors that are not already Diagnostics become a single Diagnostic without a position.
+func DiagnosticsOf(err error) *Diagnostics {
+	if diagnostics, ok := errors.Cause(err).(*Diagnostics); ok {
+		return diagnostics
+	}
+	return &Diagnostics{Diagnostics: errorDiagnostics("", err), Sources: map[string][]byte{}}
+}
+
+// FatalIfErrorf terminates app with an error message if err is not nil, as app.FatalIfErrorf
+// does, except that Diagnostics are written in colour if app.Stderr is a terminal.
+//
+// Use it in place of app.FatalIfErrorf to report errors from Parse or a Loader.
+func FatalIfErrorf(app *kong.Kong, err error, args ...interface{}) {
+	fatalIfErrorf(app, err, IsTerminal(app.Stderr), args...)
+}
+
+func fatalIfErrorf(app *kong.Kong, err error, colour bool, args ...interface{}) {
+	diagnostics, ok := errors.Cause(err).(*Diagnostics)
+	if !ok || !colour {
+		app.FatalIfErrorf(err, args...)
+		return
+	}
+	// Keep the context the diagnostics were wrapped in, such as the flag being resolved.
+	msg := strings.TrimSuffix(strings.TrimSuffix(err.Error(), diagnostics.Error()), ": ")
+	if len(args) > 0 {
+		msg = strings.TrimSuffix(fmt.Sprintf(args[0].(string), args[1:]...)+": "+msg, ": ")
+	}
+	if msg == "" {
+		msg = "invalid configuration"
+	}
+	app.Errorf("%s", msg)
+	_ = diagnostics.Write(app.Stderr, true)
+	app.Exit(1)
+}
+
+// WriteFormat writes all diagnostics to w in the given format.
+//
+// Text is coloured if colour is true, and tool names the program producing SARIF.
+func (d *Diagnostics) WriteFormat(w io.Writer, format DiagnosticsFormat, colour bool, tool string) error {
+	switch format {
+	case DiagnosticsText, "":
+		return d.Write(w, colour)
+	case DiagnosticsJSON:
+		return d.WriteJSON(w)
+	case DiagnosticsSARIF:
+		return d.WriteSARIF(w, tool)
+	default:
+		return errors.Errorf("unknown diagnostics format %q", format)
+	}
+}
+
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type jsonRange struct {
+	Start jsonPosition `json:"start"`
+	End   jsonPosition `json:"end"`
+}
+
+type jsonDiagnostic struct {
+	File     string     `json:"file,omitempty"`
+	Range    *jsonRange `json:"range,omitempty"`
+	Severity string     `json:"severity"`
+	Rule     string     `json:"rule"`
+	Summary  string     `json:"summary"`
+	Message  string     `json:"message"`
+}
+
+// WriteJSON writes each diagnostic to w as a JSON object on its own line, eg.
+//
+//	{"file":"config.hcl","range":{"start":{"line":3,"column":1},"end":{"line":3,"column":8}},"severity":"error","rule":"unknown-key","summary":"Unknown configuration key","message":"Unknown configuration key \"unknown\"."}
+//
+// "file" and "range" are omitted for diagnostics without a position, and the end of the range
+// is the same as the start if it is not known.
+func (d *Diagnostics) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, diag := range d.Diagnostics {
+		out := jsonDiagnostic{
+			File:     diag.Pos.Filename,
+			Severity: severityName(diag.Severity),
+			Rule:     ruleID(diag.Rule),
+			Summary:  diag.Summary,
+			Message:  message(diag),
+		}
+		if diag.Pos.IsValid() {
+			start, end := diagnosticRange(diag)
+			out.Range = &jsonRange{
+				Start: jsonPosition{Line: start.Line, Column: start.Column},
+				End:   jsonPosition{Line: end.Line, Column: end.Column},
+			}
+		}
+		if err := enc.Encode(out); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// WriteSARIF writes all diagnostics to w as a SARIF 2.1.0 log with a single run of the named tool.
+func (d *Diagnostics) WriteSARIF(w io.Writer, tool string) error {
+	run := sarifRun{Tool: sarifTool{Driver: sarifDriver{Name: tool, Rules: []sarifRule{}}}, Results: []sarifResult{}}
+	rules := map[string]bool{}
+	for _, diag := range d.Diagnostics {
+		id := ruleID(diag.Rule)
+		if !rules[id] {
+			rules[id] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: summary(diag.Rule)}})
+		}
+		result := sarifResult{RuleID: id, Level: severityName(diag.Severity), Message: sarifMessage{Text: message(diag)}}
+		if diag.Pos.Filename != "" {
+			location := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(diag.Pos.Filename)}}
+			if diag.Pos.IsValid() {
+				start, end := diagnosticRange(diag)
+				location.Region = &sarifRegion{StartLine: start.Line, StartColumn: start.Column, EndLine: end.Line, EndColumn: end.Column}
+			}
+			result.Locations = []sarifLocation{{PhysicalLocation: location}}
+		}
+		run.Results = append(run.Results, result)
+	}
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.WithStack(enc.Encode(log))
+}
+
+func severityName(severity Severity) string {
+	if severity == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+func ruleID(rule string) string {
+	if rule == "" {
+		return RuleInvalid
+	}
+	return rule
+}
+
+// The message of a diagnostic, which is its detail if it has one.
+func message(diag Diagnostic) string {
+	if diag.Detail != "" {
+		return diag.Detail
+	}
+	return diag.Summary
+}
+
+// The start and end of the source a diagnostic applies to.
+func diagnosticRange(diag Diagnostic) (Position, Position) {
+	if !diag.End.IsValid() {
+		return diag.Pos, diag.Pos
+	}
+	return diag.Pos, diag.End
+}
@@ -0,0 +1,258 @@
+package core
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/pkg/errors"
+)
+
+// Resolver resolves kong Flags from a configuration Tree.
+type Resolver struct {
+	tree        *Tree
+	config      map[string]interface{}
+	profiles    map[string]map[string]interface{}
+	profileFlag string
+	allowed     []string
+	mode        ValidationMode
+	warn        func(Warning)
+	// Deprecated keys, mapped to their replacements.
+	renamed   map[string]string
+	normalise bool
+	style     KeyStyle
+	// Set by DisableFileAccess, and passed on to the Parser.
+	fileAccessDisabled bool
+	// Path to config in tree, if this is a Section of another Resolver.
+	root []string
+}
+
+// An Option configures how a Resolver is loaded.
+type Option func(r *Resolver)
+
+// NewLoader creates a Kong configuration loader that parses configuration with parser.
+func NewLoader(parser Parser, options ...Option) kong.ConfigurationLoader {
+	return func(r io.Reader) (kong.Resolver, error) {
+		filename := ""
+		if named, ok := r.(interface{ Name() string }); ok {
+			filename = named.Name()
+		}
+		source, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		resolver := newResolver(NewTree(map[string]interface{}{}), options)
+		tree, err := parser(filename, source, !resolver.fileAccessDisabled)
+		if err != nil {
+			return nil, err
+		}
+		resolver.tree, resolver.config = tree, tree.Root
+		if err := resolver.load(); err != nil {
+			return nil, err
+		}
+		return resolver, nil
+	}
+}
+
+// New creates a Resolver for a configuration Tree.
+//
+// An error is returned if the Tree contains values of unsupported types.
+func New(tree *Tree, options ...Option) (*Resolver, error) {
+	r := newResolver(tree, options)
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Check the Tree of the Resolver and prepare its configuration for resolving.
+func (r *Resolver) load() error {
+	if err := r.tree.check(nil, r.tree.Root); err != nil {
+		return err
+	}
+	if err := r.extractProfiles(); err != nil {
+		return err
+	}
+	r.normaliseConfig()
+	return nil
+}
+
+func newResolver(tree *Tree, options []Option) *Resolver {
+	r := &Resolver{
+		tree:    tree,
+		config:  tree.Root,
+		warn:    WarningWriter(os.Stderr),
+		renamed: map[string]string{},
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// DisableFileAccess prevents the Parser from reading files named in configuration.
+//
+// It applies to Parsers that can read files, such as with HCL functions.
+func DisableFileAccess() Option {
+	return func(r *Resolver) {
+		r.fileAccessDisabled = true
+	}
+}
+
+func (r *Resolver) Resolve(context *kong.Context, parent *kong.Path, flag *kong.Flag) (interface{}, error) { // nolint: golint
+	// The selected profile, if any, is overlaid on top of the base configuration.
+	configs := []map[string]interface{}{r.config}
+	roots := [][]string{r.root}
+	name := activeProfile(context, r.profileFlag)
+	if profile := r.profiles[name]; profile != nil && flag.Name != r.profileFlag {
+		configs = append([]map[string]interface{}{profile}, configs...)
+		roots = append([][]string{{profileBlock, name}}, roots...)
+	}
+	for _, path := range r.pathsForFlag(context, parent, flag) {
+		for i, config := range configs {
+			value, err := r.findRenamed(config, roots[i], path)
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				return convertValue(flag, value)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Build the candidate paths for a flag, from the most specific scope to the least.
+//
+// A flag may be overridden inside the block of any selected command at or below
+// the command that declares it, with the most deeply nested command taking precedence.
+func (r *Resolver) pathsForFlag(context *kong.Context, parent *kong.Path, flag *kong.Flag) [][]string {
+	declared := parent.Node()
+	selected := declared
+	if context != nil && context.Selected() != nil {
+		selected = context.Selected()
+	}
+	paths := [][]string{}
+	for n := selected; n != nil; n = n.Parent {
+		paths = append(paths, flagPaths(nodePath(n), flag)...)
+		if n == declared {
+			return r.normalisePaths(paths)
+		}
+	}
+	// The declaring node is not an ancestor of the selected command.
+	return r.normalisePaths(flagPaths(nodePath(declared), flag))
+}
+
+// Build a string path up to this node.
+func nodePath(node *kong.Node) []string {
+	path := []string{}
+	for n := node; n != nil && n.Type != kong.ApplicationNode; n = n.Parent {
+		path = append([]string{n.Name}, path...)
+	}
+	return path
+}
+
+// Build the string paths to a flag within the scope of a node path.
+//
+// Flags in a group may be configured either inside a block named after the
+// group's key, or directly.
+func flagPaths(scope []string, flag *kong.Flag) [][]string {
+	paths := [][]string{}
+	if flag.Group != nil && flag.Group.Key != "" {
+		path := append([]string{}, scope...)
+		paths = append(paths, append(path, flag.Group.Key, flag.Name))
+	}
+	path := append([]string{}, scope...)
+	return append(paths, append(path, flag.Name))
+}
+
+// Find the value that path, in canonical form, maps to in config, which is located at "root" in
+// the Tree.
+func (r *Resolver) find(config map[string]interface{}, root, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return config, nil
+	}
+
+	key := strings.Join(path, "-")
+	if sub, err := r.lookup(config, root, key); err != nil || sub != nil {
+		return sub, err
+	}
+	parts := strings.Split(key, "-")
+	for i := len(parts) - 1; i > 0; i-- {
+		prefix, err := r.keyIn(config, root, strings.Join(parts[:i], "-"))
+		if err != nil {
+			return nil, err
+		}
+		blocks, ok := asBlocks(config[prefix])
+		if !ok {
+			continue
+		}
+		// Later blocks take precedence over earlier ones.
+		for j := len(blocks) - 1; j >= 0; j-- {
+			value, err := r.find(blocks[j], append(append([]string{}, root...), prefix), parts[i:])
+			if err != nil || value != nil {
+				return value, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Returns the blocks in value, if it is a block or a list of blocks.
+func asBlocks(value interface{}) ([]map[string]interface{}, bool) {
+	switch value := value.(type) {
+	case []map[string]interface{}:
+		return value, true
+	case map[string]interface{}:
+		return []map[string]interface{}{value}, true
+	default:
+		return nil, false
+	}
+}
+
+func flattenNode(config interface{}) ([][]string, error) {
+	out := [][]string{}
+	switch config := config.(type) {
+	case []map[string]interface{}:
+		for _, group := range config {
+			children, err := flattenNode(group)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, children...)
+		}
+	case map[string]interface{}:
+		for key, value := range config {
+			children, err := flattenNode(value)
+			if err != nil {
+				return nil, errors.Wrap(err, key)
+			}
+			if len(children) == 0 {
+				out = append(out, []string{key})
+			} else {
+				for _, childValue := range children {
+					out = append(out, append([]string{key}, childValue...))
+				}
+			}
+		}
+
+	case []interface{}:
+		for _, el := range config {
+			children, err := flattenNode(el)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, children...)
+		}
+
+	// A nil value is an explicitly unset key.
+	case nil, bool, float64, int, int64, uint64, string:
+		return nil, nil
+
+	default:
+		return nil, errors.Errorf("unsupported value type %T", config)
+	}
+	return out, nil
+}
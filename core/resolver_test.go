@@ -0,0 +1,215 @@
+package core
+
+import (
+	"io"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFind(t *testing.T) {
+	config := map[string]interface{}{
+		"flag": "flag",
+		"db": []map[string]interface{}{
+			{"dsn": "first", "trace": true},
+			{"dsn": "second"},
+		},
+		"object": map[string]interface{}{"key": "value"},
+		"scalar": "scalar",
+	}
+	tests := []struct {
+		path     []string
+		expected interface{}
+	}{
+		{[]string{"flag"}, "flag"},
+		{[]string{"db", "dsn"}, "second"},
+		{[]string{"db-trace"}, true},
+		{[]string{"object", "key"}, "value"},
+		{[]string{"scalar", "key"}, nil},
+		{[]string{"missing"}, nil},
+	}
+	for _, test := range tests {
+		value, err := (&Resolver{}).find(config, nil, test.path)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, value, "%v", test.path)
+	}
+}
+
+func TestFlattenNodeUnsupportedType(t *testing.T) {
+	_, err := flattenNode(map[string]interface{}{
+		"db": []map[string]interface{}{{"dsn": struct{}{}}},
+	})
+	require.EqualError(t, err, "db: dsn: unsupported value type struct {}")
+}
+
+func TestFlattenNodeList(t *testing.T) {
+	paths, err := flattenNode([]interface{}{
+		map[string]interface{}{"left": "left"},
+		map[string]interface{}{"right": "right"},
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, [][]string{{"left"}, {"right"}}, paths)
+}
+
+func TestGroupedFlags(t *testing.T) {
+	var cli struct {
+		Grouped string `group:"group"`
+		Plain   string `group:"group"`
+	}
+	tree := NewTree(map[string]interface{}{
+		"group": []map[string]interface{}{{"grouped": "grouped"}},
+		"plain": "plain",
+	})
+	resolver, err := New(tree)
+	require.NoError(t, err)
+	parser, err := kong.New(&cli, kong.Resolvers(resolver))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "grouped", cli.Grouped)
+	assert.Equal(t, "plain", cli.Plain)
+}
+
+func TestValidationPosition(t *testing.T) {
+	var cli struct {
+		Flag string
+	}
+	tree := NewTree(map[string]interface{}{
+		"db": []map[string]interface{}{{"dsn": "root@/database"}},
+	})
+	tree.SetPosition([]string{"db"}, Position{Filename: "config.hcl", Line: 1, Column: 1})
+	tree.SetPosition([]string{"db", "dsn"}, Position{Filename: "config.hcl", Line: 2, Column: 3})
+	resolver, err := New(tree)
+	require.NoError(t, err)
+	parser, err := kong.New(&cli, kong.Resolvers(resolver))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.EqualError(t, err, `config.hcl:2:3: unknown configuration key "db-dsn"`)
+}
+
+func TestIntrospection(t *testing.T) {
+	tree := NewTree(map[string]interface{}{
+		"flag":      "value",
+		"db-dsn":    "flat",
+		"db":        []map[string]interface{}{{"dsn": "first", "trace": true}, {"pool": map[string]interface{}{"size": 1}}},
+		"plugins":   map[string]interface{}{"auth": map[string]interface{}{"enabled": true}},
+		"unclaimed": 1,
+	})
+	tree.SetPosition([]string{"unclaimed"}, Position{Filename: "config.hcl", Line: 5, Column: 1})
+	r, err := New(tree, AllowKeys("plugins"), WarningHandler(func(Warning) {}))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"db-dsn", "db-pool-size", "db-trace", "flag", "plugins-auth-enabled", "unclaimed"}, r.Keys())
+
+	value, ok := r.Get("db", "dsn")
+	assert.True(t, ok)
+	assert.Equal(t, "flat", value)
+	value, ok = r.Get("db", "pool", "size")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+	_, ok = r.Get("db", "missing")
+	assert.False(t, ok)
+
+	db := r.Section("db")
+	assert.Equal(t, []string{"dsn", "pool-size", "trace"}, db.Keys())
+	value, _ = db.Get("dsn")
+	assert.Equal(t, "flat", value)
+	value, _ = r.Section("plugins").Section("auth").Get("enabled")
+	assert.Equal(t, true, value)
+	assert.Empty(t, r.Section("missing").Keys())
+
+	var cli struct {
+		Flag string
+		DB   struct {
+			DSN   string
+			Trace bool
+		} `embed:"" prefix:"db-"`
+	}
+	parser, err := kong.New(&cli)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db-pool-size", "unclaimed"}, r.Unused(parser.Model))
+	require.EqualError(t, r.Validate(parser.Model), `unknown configuration key "db-pool-size"`)
+}
+
+type rawConfig map[string]interface{}
+
+func (c *rawConfig) Decode(ctx *kong.DecodeContext) error {
+	blocks, _ := asBlocks(ctx.Scan.Pop().Value)
+	*c = rawConfig{}
+	for _, block := range blocks {
+		for key, value := range block {
+			(*c)[key] = value
+		}
+	}
+	return nil
+}
+
+func TestNormaliseKeysKeepsValues(t *testing.T) {
+	var cli struct {
+		Env     map[string]string
+		Plugins rawConfig
+		DB      struct {
+			MaxConns int
+		} `embed:"" prefix:"db-"`
+	}
+	tree := NewTree(map[string]interface{}{
+		"env":     map[string]interface{}{"MY_VAR": "x", "MY-VAR": "y"},
+		"plugins": []map[string]interface{}{{"auth_basic": map[string]interface{}{"user_name": "admin"}, "auth-basic": true}},
+		"db":      []map[string]interface{}{{"max_conns": 5}},
+	})
+	resolver, err := New(tree, NormaliseKeys(SnakeCase))
+	require.NoError(t, err)
+	parser, err := kong.New(&cli, kong.Resolvers(resolver))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"MY_VAR": "x", "MY-VAR": "y"}, cli.Env)
+	assert.Equal(t, rawConfig{"auth_basic": map[string]interface{}{"user_name": "admin"}, "auth-basic": true}, cli.Plugins)
+	assert.Equal(t, 5, cli.DB.MaxConns)
+	assert.Empty(t, resolver.Unused(parser.Model))
+
+	tree = NewTree(map[string]interface{}{
+		"db": []map[string]interface{}{{"max_conns": 5, "max-conns": 6}},
+	})
+	tree.SetPosition([]string{"db", "max_conns"}, Position{Filename: "config.hcl", Line: 3, Column: 3})
+	resolver, err = New(tree, NormaliseKeys(SnakeCase))
+	require.NoError(t, err)
+	require.EqualError(t, resolver.Validate(parser.Model), `config.hcl:3:3: configuration keys "max-conns" and "max_conns" conflict`)
+}
+
+// A flag that records the KeyStyle configured for the application when it is parsed.
+type keyStyleFlag bool
+
+var configuredKeyStyle KeyStyle
+
+func (keyStyleFlag) BeforeApply(vars kong.Vars) error { // nolint: golint
+	configuredKeyStyle = ConfiguredKeyStyle(vars)
+	return nil
+}
+
+func TestConfiguredKeyStyle(t *testing.T) {
+	var cli struct {
+		Style keyStyleFlag
+	}
+	for _, style := range []KeyStyle{KebabCase, SnakeCase} {
+		loader := func(r io.Reader) (kong.Resolver, error) {
+			return New(NewTree(map[string]interface{}{}), NormaliseKeys(style))
+		}
+		parser, err := kong.New(&cli, Configuration(loader))
+		require.NoError(t, err)
+		configuredKeyStyle = -1
+		_, err = parser.Parse([]string{"--style"})
+		require.NoError(t, err)
+		assert.Equal(t, style, configuredKeyStyle)
+	}
+
+	// Without Configuration, keys are kebab-case.
+	parser, err := kong.New(&cli)
+	require.NoError(t, err)
+	configuredKeyStyle = -1
+	_, err = parser.Parse([]string{"--style"})
+	require.NoError(t, err)
+	assert.Equal(t, KebabCase, configuredKeyStyle)
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/pkg/errors"
+)
+
+// StdinFilename is the filename reported for HCL read from stdin.
+const StdinFilename = "<stdin>"
+
+// A DecodeOption configures how HCL values are decoded.
+type DecodeOption func(o *decodeOptions)
+
+type decodeOptions struct {
+	guessFiles bool
+}
+
+// GuessFiles restores the original behaviour of decoding values, where a value is read as a file
+// if a file of that name exists, and is otherwise parsed as HCL.
+//
+// This is ambiguous, as a mistyped filename is reported as invalid HCL, and is only provided for
+// compatibility.
+func GuessFiles() DecodeOption {
+	return func(o *decodeOptions) {
+		o.guessFiles = true
+	}
+}
+
+// ReadSource returns the HCL source that a string value refers to.
+//
+// A value of the form "@path" is read from the file at path, "-" is read from stdin, and
+// anything else is HCL source itself. "filename" is empty if the value is HCL source.
+func ReadSource(value string, options ...DecodeOption) (filename string, source []byte, err error) {
+	opts := &decodeOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	switch {
+	case opts.guessFiles:
+		filename = kong.ExpandPath(value)
+		source, err = ioutil.ReadFile(filename) // nolint: gosec
+		if os.IsNotExist(err) {
+			return "", []byte(value), nil
+		}
+
+	case value == "-":
+		filename = StdinFilename
+		source, err = ioutil.ReadAll(os.Stdin)
+
+	case strings.HasPrefix(value, "@"):
+		filename = kong.ExpandPath(strings.TrimPrefix(value, "@"))
+		source, err = ioutil.ReadFile(filename) // nolint: gosec
+
+	default:
+		return "", []byte(value), nil
+	}
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "invalid HCL in %q", filename)
+	}
+	return filename, source, nil
+}
+
+// ExpandFiles returns the files matching a glob pattern, in lexical order.
+//
+// A pattern without glob metacharacters is returned as is, while a pattern with them must match
+// at least one file.
+func ExpandFiles(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pattern %q", pattern)
+	}
+	if len(matches) == 0 {
+		return nil, errors.Errorf("no files match %q", pattern)
+	}
+	return matches, nil
+}
+
+// HCL file extensions, longest first.
+var hclExtensions = []string{".hcl.json", ".hcl", ".json"}
+
+// DirFiles returns the HCL and HCL JSON files in dir, in lexical order, keyed by their
+// base names without extension.
+//
+// Subdirectories and other files are ignored. Two files with the same key are an error.
+func DirFiles(dir string) (keys []string, files map[string]string, err error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	files = map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		for _, ext := range hclExtensions {
+			if !strings.HasSuffix(name, ext) {
+				continue
+			}
+			key := strings.TrimSuffix(name, ext)
+			if other, ok := files[key]; ok {
+				return nil, nil, errors.Errorf("%s and %s both define %q", other, filepath.Join(dir, name), key)
+			}
+			files[key] = filepath.Join(dir, name)
+			keys = append(keys, key)
+			break
+		}
+	}
+	return keys, files, nil
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"sort"
+	"strings"
+)
+
+// The greatest edit distance between an unknown key and a suggested replacement.
+const maxSuggestionDistance = 2
+
+// IsUnknown returns true if the key at path does not configure a flag, is not a prefix of one,
+// and is not allowed by AllowKeys.
+func (l *Layout) IsUnknown(path []string) bool {
+	key, kind := l.Classify(path)
+	return kind == KeyUnknown && l.r.isUnknown(l.schema, key)
+}
+
+// Suggest returns the closest names for the unknown key at path, which is a block if block is
+// true, relative to the block enclosing it and in the configured KeyStyle.
+//
+// Suggestions are keys of flags, or for blocks also prefixes of them, within the block
+// enclosing path. More than one suggestion is returned if several are equally close, and none
+// if the key is not unknown or no key is close enough.
+func (l *Layout) Suggest(path []string, block bool) []string {
+	if len(path) == 0 || !l.IsUnknown(path) {
+		return nil
+	}
+	key := l.r.normaliseKey(strings.Join(path, "-"))
+	parent := ""
+	if len(path) > 1 {
+		parent = l.r.normaliseKey(strings.Join(path[:len(path)-1], "-")) + "-"
+	}
+	name := strings.TrimPrefix(key, parent)
+	best := maxSuggestionDistance + 1
+	suggestions := []string{}
+	for _, candidate := range l.candidates(block) {
+		if !strings.HasPrefix(candidate, parent) {
+			continue
+		}
+		distance := levenshtein(name, strings.TrimPrefix(candidate, parent))
+		if distance >= len(name) || distance > best {
+			continue
+		}
+		if distance < best {
+			best = distance
+			suggestions = suggestions[:0]
+		}
+		suggestions = append(suggestions, l.r.style.Format(strings.TrimPrefix(candidate, parent)))
+	}
+	sort.Strings(suggestions)
+	return suggestions
+}
+
+// Keys that an unknown key may be replaced with, including the prefixes of keys if the unknown
+// key is a block.
+func (l *Layout) candidates(block bool) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, key)
+		}
+	}
+	keys := append([]string{}, l.schema.rawPrefixes...)
+	for key := range l.schema.valid {
+		if _, ok := l.r.renamed[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		add(key)
+		if !block {
+			continue
+		}
+		for i := strings.Index(key, "-"); i > 0; i = nextHyphen(key, i) {
+			add(key[:i])
+		}
+	}
+	return out
+}
+
+func nextHyphen(key string, i int) int {
+	if j := strings.Index(key[i+1:], "-"); j >= 0 {
+		return i + 1 + j
+	}
+	return -1
+}
+
+// The edit distance between a and b.
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(br)]
+}
+
+func minInt(values ...int) int {
+	out := values[0]
+	for _, value := range values[1:] {
+		if value < out {
+			out = value
+		}
+	}
+	return out
+}
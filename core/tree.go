@@ -0,0 +1,207 @@
+// Package core implements kong configuration resolution over an abstract configuration tree.
+//
+// Configuration syntaxes such as HCL1, HCL2 and JSON are supported by Parsers that convert source
+// into a Tree. Lookup, validation and conversion of values are then performed here, so they behave
+// identically regardless of the syntax used.
+//
+// Applications should generally use this package via github.com/alecthomas/kong-hcl or
+// github.com/alecthomas/kong-hcl/v2.
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A Parser converts configuration source into a Tree.
+//
+// "filename" is empty if the source was not read from a file. If "fileAccess" is false, the
+// configuration must not be able to read other files.
+type Parser func(filename string, source []byte, fileAccess bool) (*Tree, error)
+
+// Position of a key in configuration source.
+type Position struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+func (p Position) String() string {
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
+// IsValid returns true if the Position refers to a location in source.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// A Tree of configuration values.
+//
+// Values are one of nil (an unset key), bool, string, int, int64, uint64, float64, []interface{},
+// map[string]interface{} or []map[string]interface{}. Maps and slices of maps are blocks, whose
+// keys are appended to the key of the block with a hyphen when looking up flags.
+type Tree struct {
+	Root      map[string]interface{}
+	positions map[string]Position
+}
+
+// NewTree creates a new Tree.
+func NewTree(root map[string]interface{}) *Tree {
+	return &Tree{Root: root, positions: map[string]Position{}}
+}
+
+// SetPosition records the position of the key at "path" through the Tree.
+//
+// Block labels are part of the path. The first position recorded for a path is retained.
+func (t *Tree) SetPosition(path []string, pos Position) {
+	key := positionKey(path)
+	if _, ok := t.positions[key]; !ok {
+		t.positions[key] = pos
+	}
+}
+
+// Position of the key at "path", or of its closest ancestor with a known position.
+func (t *Tree) Position(path []string) (Position, bool) {
+	for i := len(path); i > 0; i-- {
+		if pos, ok := t.positions[positionKey(path[:i])]; ok {
+			return pos, true
+		}
+	}
+	return Position{}, false
+}
+
+// TreeFromMap creates a Tree from Go values.
+//
+// Values are converted to the types supported by Tree: integers of all sizes to int64 or uint64,
+// floats to float64, and slices and string-keyed maps to []interface{} and map[string]interface{}
+// respectively. Other types are an error.
+func TreeFromMap(config map[string]interface{}) (*Tree, error) {
+	root, err := normaliseValue(reflect.ValueOf(config))
+	if err != nil {
+		return nil, err
+	}
+	return NewTree(root.(map[string]interface{})), nil
+}
+
+func normaliseValue(v reflect.Value) (interface{}, error) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Slice, reflect.Array:
+		if blocks, ok := v.Interface().([]map[string]interface{}); ok {
+			out := make([]map[string]interface{}, 0, len(blocks))
+			for _, block := range blocks {
+				normalised, err := normaliseValue(reflect.ValueOf(block))
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, normalised.(map[string]interface{}))
+			}
+			return out, nil
+		}
+		out := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			el, err := normaliseValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, el)
+		}
+		return out, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, errors.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		out := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			value, err := normaliseValue(v.MapIndex(key))
+			if err != nil {
+				return nil, errors.Wrap(err, key.String())
+			}
+			out[key.String()] = value
+		}
+		return out, nil
+	default:
+		return nil, errors.Errorf("unsupported value type %s", v.Type())
+	}
+}
+
+// Check that every value in the tree is of a supported type.
+func (t *Tree) check(path []string, value interface{}) error {
+	switch value := value.(type) {
+	case nil, bool, string, int, int64, uint64, float64:
+		return nil
+	case []interface{}:
+		for _, el := range value {
+			if err := t.check(path, el); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []map[string]interface{}:
+		for _, block := range value {
+			if err := t.check(path, block); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := t.check(append(append([]string{}, path...), key), value[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		pos, _ := t.Position(path)
+		return &Error{Pos: pos, Message: fmt.Sprintf("%s: unsupported value type %T", strings.Join(path, "-"), value)}
+	}
+}
+
+func positionKey(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// An Error in configuration, at a position in its source if known.
+type Error struct {
+	Pos Position
+	// Rule identifying the kind of problem, if known, eg. RuleUnknownKey.
+	Rule    string
+	Message string
+}
+
+// Error returns the message, prefixed with its position if the source has a filename.
+func (e *Error) Error() string {
+	if e.Pos.Filename == "" || !e.Pos.IsValid() {
+		return e.Message
+	}
+	return e.Pos.String() + ": " + e.Message
+}
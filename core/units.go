@@ -0,0 +1,278 @@
+package core
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/pkg/errors"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Multipliers for byte size units, keyed by lower-case unit name.
+var byteSizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+// ByteSize is a number of bytes that can be configured with a decimal ("10MB") or binary ("10MiB") unit.
+//
+// Plain numbers are interpreted as bytes, unless the flag has a "unit" tag, eg.
+//
+//	MaxBody konghcl.ByteSize `unit:"MiB"`
+type ByteSize int64
+
+// Decode implements kong.MapperValue.
+func (b *ByteSize) Decode(ctx *kong.DecodeContext) error {
+	return decodeByteSize(ctx, reflect.ValueOf(b).Elem())
+}
+
+func (b ByteSize) String() string {
+	units := []string{"PiB", "TiB", "GiB", "MiB", "KiB"}
+	for _, unit := range units {
+		size := ByteSize(byteSizeUnits[strings.ToLower(unit)])
+		if b != 0 && b%size == 0 {
+			return strconv.FormatInt(int64(b/size), 10) + unit
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+// ByteSizeMapper decodes byte sizes with optional units into any integer field.
+//
+//	var cli struct {
+//	  MaxBody int64 `type:"bytesize"`
+//	}
+//
+//	func main() {
+//	  kong.Parse(&cli, kong.NamedMapper("bytesize", konghcl.ByteSizeMapper))
+//	}
+var ByteSizeMapper = kong.MapperFunc(decodeByteSize)
+
+func decodeByteSize(ctx *kong.DecodeContext, target reflect.Value) error {
+	token, err := ctx.Scan.PopValue("size")
+	if err != nil {
+		return err
+	}
+	var size *big.Rat
+	if s, ok := token.Value.(string); ok {
+		size, err = parseByteSize(s, ctx.Value.Tag.Get("unit"))
+	} else {
+		size, err = scaleNumber(token.Value, ctx.Value.Tag.Get("unit"), byteSizeUnits)
+	}
+	if err != nil {
+		return err
+	}
+	if !size.IsInt() {
+		return errors.Errorf("expected a whole number of bytes but got %s", ratString(size))
+	}
+	n := size.Num()
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !n.IsInt64() || target.OverflowInt(n.Int64()) {
+			return errors.Errorf("byte size %s overflows %s", n, target.Type())
+		}
+		target.SetInt(n.Int64())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !n.IsUint64() || target.OverflowUint(n.Uint64()) {
+			return errors.Errorf("byte size %s overflows %s", n, target.Type())
+		}
+		target.SetUint(n.Uint64())
+	default:
+		return errors.Errorf("byte sizes can only be decoded into integers, not %s", target.Type())
+	}
+	return nil
+}
+
+// ParseByteSize parses a byte size such as "512", "10MB" or "1.5GiB" into a number of bytes.
+func ParseByteSize(s string) (int64, error) {
+	size, err := parseByteSize(s, "")
+	if err != nil {
+		return 0, err
+	}
+	if !size.IsInt() || !size.Num().IsInt64() {
+		return 0, errors.Errorf("invalid byte size %q", s)
+	}
+	return size.Num().Int64(), nil
+}
+
+// Parse a byte size exactly, using defaultUnit if s is a plain number.
+func parseByteSize(s string, defaultUnit string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+	n, ok := new(big.Rat).SetString(s[:i])
+	if i == 0 || !ok {
+		return nil, errors.Errorf("invalid byte size %q", s)
+	}
+	if strings.HasPrefix(s, "-") {
+		return nil, errors.Errorf("invalid byte size %q: byte sizes can't be negative", s)
+	}
+	unitName := strings.TrimSpace(s[i:])
+	if unitName == "" {
+		unitName = defaultUnit
+	}
+	unit, ok := byteSizeUnits[strings.ToLower(unitName)]
+	if !ok {
+		return nil, errors.Errorf("invalid byte size %q: unknown unit %q", s, unitName)
+	}
+	return n.Mul(n, new(big.Rat).SetInt64(unit)), nil
+}
+
+// Scale a numeric value exactly by the named unit.
+func scaleNumber(value interface{}, unit string, units map[string]int64) (*big.Rat, error) {
+	n, ok := toRat(value)
+	if !ok {
+		return nil, errors.Errorf("expected a number but got %v (%T)", value, value)
+	}
+	multiplier, ok := units[strings.ToLower(unit)]
+	if !ok {
+		return nil, errors.Errorf("unknown unit %q", unit)
+	}
+	return n.Mul(n, new(big.Rat).SetInt64(multiplier)), nil
+}
+
+// Convert a number to a rational exactly, so that integers beyond 2^53 keep their precision.
+func toRat(value interface{}) (*big.Rat, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Rat).SetInt64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(v.Uint())), true
+	case reflect.Float32, reflect.Float64:
+		if math.IsInf(v.Float(), 0) || math.IsNaN(v.Float()) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(v.Float()), true
+	default:
+		return nil, false
+	}
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// Format a rational as a decimal for messages.
+func ratString(r *big.Rat) string {
+	f, _ := r.Float64()
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Convert configuration values into a form the flag's mapper understands.
+//
+// Numeric values for time.Duration flags are interpreted in the unit given by
+// the flag's "unit" tag, eg.
+//
+//	Timeout time.Duration `unit:"s"`
+//
+// Numbers for integer and floating point flags are converted to the flag's
+// kind, and fractional values for integer flags are rejected.
+func convertValue(flag *kong.Flag, value interface{}) (interface{}, error) {
+	target := flag.Target.Type()
+	switch {
+	case target == durationType:
+		return convertDuration(flag, value)
+	case flag.Tag.Type != "" || reflect.PtrTo(target).Implements(mapperValueType):
+		// Custom mappers handle their own conversions.
+		return value, nil
+	case flag.IsSlice():
+		elements, ok := value.([]interface{})
+		if !ok {
+			return value, nil
+		}
+		out := make([]interface{}, len(elements))
+		for i, el := range elements {
+			converted, err := convertNumber(target.Elem().Kind(), el)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = converted
+		}
+		return out, nil
+	default:
+		return convertNumber(target.Kind(), value)
+	}
+}
+
+var mapperValueType = reflect.TypeOf((*kong.MapperValue)(nil)).Elem()
+
+func convertDuration(flag *kong.Flag, value interface{}) (interface{}, error) {
+	n, ok := toRat(value)
+	if !ok {
+		return value, nil
+	}
+	unitTag := flag.Tag.Get("unit")
+	if unitTag == "" {
+		return nil, errors.Errorf("expected a duration such as \"30s\" but got %v; add a \"unit\" tag to the flag to allow plain numbers", value)
+	}
+	unit, err := time.ParseDuration("1" + unitTag)
+	if err != nil {
+		return nil, errors.Errorf("invalid duration unit %q", unitTag)
+	}
+	// Durations are scaled exactly, and fractions of a nanosecond truncated.
+	n.Mul(n, new(big.Rat).SetInt64(int64(unit)))
+	ns := new(big.Int).Quo(n.Num(), n.Denom())
+	if !ns.IsInt64() {
+		return nil, errors.Errorf("duration %v%s overflows time.Duration", value, unitTag)
+	}
+	return time.Duration(ns.Int64()).String(), nil
+}
+
+func convertNumber(kind reflect.Kind, value interface{}) (interface{}, error) {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, ok := value.(float64)
+		if !ok {
+			return value, nil
+		}
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, errors.Errorf("expected an integer but got %v", f)
+		}
+		return int64(f), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f, ok := value.(float64)
+		if !ok {
+			return value, nil
+		}
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+			return nil, errors.Errorf("expected an unsigned integer but got %v", f)
+		}
+		return uint64(f), nil
+	case reflect.Float32, reflect.Float64:
+		if f, ok := toFloat(value); ok {
+			return f, nil
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,369 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/pkg/errors"
+)
+
+// ValidationMode controls how problems found by Resolver.Validate are reported.
+type ValidationMode int
+
+// Validation modes.
+const (
+	// ValidateStrict fails validation on unknown keys. Other problems are reported as warnings.
+	ValidateStrict ValidationMode = iota
+	// ValidateWarn reports all problems as warnings.
+	ValidateWarn
+	// ValidateIgnore does not report any problems.
+	ValidateIgnore
+)
+
+// Rules identifying the kind of a configuration problem.
+const (
+	RuleUnknownKey   = "unknown-key"
+	RuleDeprecated   = "deprecated"
+	RuleShadowed     = "shadowed"
+	RuleConflict     = "conflict"
+	RuleTypeMismatch = "type-mismatch"
+)
+
+// A Warning about configuration that does not prevent it from being used.
+type Warning struct {
+	Pos     Position
+	Rule    string
+	Key     string
+	Message string
+}
+
+func (w Warning) String() string {
+	return (&Error{Pos: w.Pos, Rule: w.Rule, Message: w.Message}).Error()
+}
+
+// Validation sets the ValidationMode. The default is ValidateStrict.
+func Validation(mode ValidationMode) Option {
+	return func(r *Resolver) {
+		r.mode = mode
+	}
+}
+
+// WarningHandler sets the function that configuration warnings are delivered to.
+//
+// The default writes warnings to os.Stderr.
+func WarningHandler(handler func(Warning)) Option {
+	return func(r *Resolver) {
+		r.warn = handler
+	}
+}
+
+// WarningWriter returns a warning handler that writes each warning to w on its own line.
+//
+//	loader := konghcl.NewLoader(konghcl.WarningHandler(konghcl.WarningWriter(logFile)))
+func WarningWriter(w io.Writer) func(Warning) {
+	return func(warning Warning) {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+}
+
+// DeprecatedKey permits the configuration key "key" as a deprecated spelling of "replacement".
+//
+// The value of "key" is used for the flag of "replacement" if the latter is not configured, and
+// its use is reported as a warning.
+func DeprecatedKey(key, replacement string) Option {
+	return func(r *Resolver) {
+		r.renamed[key] = replacement
+	}
+}
+
+// The configuration keys of an Application.
+type schema struct {
+	valid map[string]bool
+	// Flags with a MapperValue accept arbitrary keys below their own.
+	rawPrefixes []string
+	// Deprecation messages for keys of flags with a "deprecated" tag.
+	deprecated map[string]string
+	// The flag configured by each key.
+	flags map[string]*kong.Flag
+}
+
+func (r *Resolver) Validate(app *kong.Application) error { // nolint: golint
+	schema := r.schema(app)
+	if profile := selectedProfile(app, r.profileFlag); profile != "" && r.profiles[profile] == nil {
+		return errors.Errorf("unknown configuration profile %q", profile)
+	}
+	if r.mode == ValidateIgnore {
+		return nil
+	}
+	// Then check all configuration keys against the Application keys.
+	warnings, err := r.check(schema, r.config, r.root, "")
+	if err != nil {
+		return err
+	}
+	for _, name := range r.profileNames() {
+		context := fmt.Sprintf("profile %q: ", name)
+		profileWarnings, err := r.check(schema, r.profiles[name], []string{profileBlock, name}, context)
+		if err != nil {
+			return err
+		}
+		warnings = append(warnings, profileWarnings...)
+	}
+	var unknown *Error
+	for _, warning := range warnings {
+		if warning.Rule == RuleUnknownKey && r.mode == ValidateStrict {
+			if unknown == nil {
+				unknown = &Error{Pos: warning.Pos, Rule: warning.Rule, Message: warning.Message}
+			}
+			continue
+		}
+		if r.warn != nil {
+			r.warn(warning)
+		}
+	}
+	if unknown != nil {
+		return unknown
+	}
+	return nil
+}
+
+// Find all valid configuration keys from the Application.
+func (r *Resolver) schema(app *kong.Application) *schema {
+	s := &schema{valid: map[string]bool{}, deprecated: map[string]string{}, flags: map[string]*kong.Flag{}}
+	path := []string{}
+	addFlag := func(flag *kong.Flag) {
+		for _, fp := range flagPaths(path, flag) {
+			key := r.normaliseKey(strings.Join(fp, "-"))
+			s.flags[key] = flag
+			if _, ok := flag.Target.Interface().(kong.MapperValue); ok {
+				s.rawPrefixes = append(s.rawPrefixes, key)
+			} else {
+				s.valid[key] = true
+			}
+			if flag.Tag.Has("deprecated") {
+				s.deprecated[key] = flag.Tag.Get("deprecated")
+			}
+		}
+	}
+	_ = kong.Visit(app, func(node kong.Visitable, next kong.Next) error {
+		switch node := node.(type) {
+		case *kong.Node:
+			path = append(path, node.Name)
+			// Flags from enclosing commands may be overridden inside this command's block.
+			for _, flags := range node.Parent.AllFlags(false) {
+				for _, flag := range flags {
+					addFlag(flag)
+				}
+			}
+			_ = next(nil)
+			path = path[:len(path)-1]
+			return nil
+
+		case *kong.Flag:
+			addFlag(node)
+
+		default:
+			return next(nil)
+		}
+		return nil
+	})
+	for key, replacement := range r.renamed {
+		s.valid[key] = true
+		if flag, ok := s.flags[replacement]; ok {
+			s.flags[key] = flag
+		}
+	}
+	return s
+}
+
+// Check the keys in config, which is located at "root" in the Tree, returning a Warning
+// for each problem found.
+func (r *Resolver) check(schema *schema, config map[string]interface{}, root []string, context string) ([]Warning, error) {
+	keys, err := r.flattenConfig(schema, root, config)
+	if err != nil {
+		return nil, err
+	}
+	warnings := []Warning{}
+	warn := func(rule string, key string, path []string, message string) {
+		pos, _ := r.tree.Position(append(append([]string{}, root...), path...))
+		warnings = append(warnings, Warning{Pos: pos, Rule: rule, Key: key, Message: context + message})
+	}
+	for _, key := range sortedKeys(keys) {
+		settings := keys[key]
+		display := r.style.Format(key)
+		if r.isUnknown(schema, key) {
+			warn(RuleUnknownKey, display, settings[0].path, fmt.Sprintf("unknown configuration key %q", display))
+			continue
+		}
+		if replacement, ok := r.renamed[key]; ok {
+			warn(RuleDeprecated, display, settings[0].path, fmt.Sprintf("configuration key %q is deprecated, use %q instead", display, r.style.Format(replacement)))
+		} else if message, ok := schema.deprecated[key]; ok {
+			if message != "" {
+				message = ": " + message
+			}
+			warn(RuleDeprecated, display, settings[0].path, fmt.Sprintf("configuration key %q is deprecated%s", display, message))
+		}
+		// Only the last value for a key is used, so any before it are shadowed.
+		for _, setting := range settings[:len(settings)-1] {
+			warn(RuleShadowed, display, setting.path, fmt.Sprintf("configuration key %q is overridden by another value", display))
+		}
+	}
+	return warnings, nil
+}
+
+// Returns true if key does not configure any flag and is not allowed by AllowKeys.
+func (r *Resolver) isUnknown(schema *schema, key string) bool {
+	if schema.valid[key] {
+		return false
+	}
+	for _, prefix := range schema.rawPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return false
+		}
+	}
+	for _, allowed := range r.allowed {
+		if key == allowed || strings.HasPrefix(key, allowed+"-") {
+			return false
+		}
+	}
+	return true
+}
+
+// Find the value at path, falling back to any deprecated keys it replaces.
+func (r *Resolver) findRenamed(config map[string]interface{}, root, path []string) (interface{}, error) {
+	value, err := r.find(config, root, path)
+	if err != nil || value != nil {
+		return value, err
+	}
+	key := strings.Join(path, "-")
+	for _, old := range sortedRenames(r.renamed) {
+		if r.renamed[old] != key {
+			continue
+		}
+		value, err := r.find(config, root, strings.Split(old, "-"))
+		if err != nil || value != nil {
+			return value, err
+		}
+	}
+	return nil, nil
+}
+
+func sortedRenames(renamed map[string]string) []string {
+	keys := make([]string, 0, len(renamed))
+	for key := range renamed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// A place in the configuration where a key is set.
+type setting struct {
+	// Path through the config to the key.
+	path  []string
+	value interface{}
+}
+
+// Flatten config, which is located at "root" in the Tree, into canonical hyphen-separated keys,
+// mapped to every place each was set, in order.
+//
+// Blocks are only descended into until a key in schema is found, so values of map flags are
+// not flattened, and keys below those of flags with a MapperValue are kept as written.
+func (r *Resolver) flattenConfig(schema *schema, root []string, config map[string]interface{}) (map[string][]setting, error) {
+	f := &flattener{r: r, schema: schema, root: root, out: map[string][]setting{}}
+	_, err := f.flatten(nil, "", false, config)
+	return f.out, err
+}
+
+type flattener struct {
+	r      *Resolver
+	schema *schema
+	root   []string
+	out    map[string][]setting
+}
+
+// Flatten config, found at path and with the canonical key "key", returning the number of keys
+// added. Keys are normalised unless "raw" is set.
+func (f *flattener) flatten(path []string, key string, raw bool, config interface{}) (int, error) {
+	count := 0
+	switch config := config.(type) {
+	case map[string]interface{}:
+		original := map[string]string{}
+		for _, name := range sortedConfigKeys(config) {
+			keyPath := append(append([]string{}, path...), name)
+			canonical := name
+			if !raw {
+				canonical = f.r.normaliseKey(name)
+				if other, ok := original[canonical]; ok {
+					pos, _ := f.r.tree.Position(append(append([]string{}, f.root...), keyPath...))
+					return 0, &Error{Pos: pos, Rule: RuleConflict, Message: fmt.Sprintf("configuration keys %q and %q conflict", other, name)}
+				}
+				original[canonical] = name
+			}
+			joined := canonical
+			if key != "" {
+				joined = key + "-" + canonical
+			}
+			if !f.schema.valid[joined] {
+				n, err := f.flatten(keyPath, joined, raw || f.schema.isRaw(joined), config[name])
+				if _, ok := err.(*Error); err != nil && !ok {
+					return 0, errors.Wrap(err, name)
+				} else if err != nil {
+					return 0, err
+				}
+				if n > 0 {
+					count += n
+					continue
+				}
+			}
+			f.out[joined] = append(f.out[joined], setting{path: keyPath, value: config[name]})
+			count++
+		}
+
+	case []map[string]interface{}:
+		for _, block := range config {
+			n, err := f.flatten(path, key, raw, block)
+			if err != nil {
+				return 0, err
+			}
+			count += n
+		}
+
+	case []interface{}:
+		for _, el := range config {
+			n, err := f.flatten(path, key, raw, el)
+			if err != nil {
+				return 0, err
+			}
+			count += n
+		}
+
+	// A nil value is an explicitly unset key.
+	case nil, bool, float64, int, int64, uint64, string:
+
+	default:
+		return 0, errors.Errorf("unsupported value type %T", config)
+	}
+	return count, nil
+}
+
+// Returns true if key configures a flag with a MapperValue, whose keys are not normalised.
+func (s *schema) isRaw(key string) bool {
+	for _, prefix := range s.rawPrefixes {
+		if key == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string][]setting) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,88 @@
+//go:build go1.18
+// +build go1.18
+
+package konghcl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+)
+
+type fuzzCLI struct {
+	FlagName string
+	IntFlag  int
+	Ratio    float64
+	Slice    []string
+	Map      map[string]string
+	Mapped   mapperValue
+	DB       struct {
+		DSN string
+	} `embed:"" prefix:"db-"`
+	Serve struct {
+		Port int
+	} `cmd:""`
+}
+
+func FuzzLoader(f *testing.F) {
+	f.Add([]byte(testConfig))
+	f.Add([]byte(`db { dsn = "root@/database" }`))
+	f.Add([]byte(`serve { port = 8080 }`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		resolver, err := Loader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		var cli fuzzCLI
+		parser, err := kong.New(&cli, kong.Resolvers(resolver), kong.Exit(func(int) {}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = parser.Parse([]string{"serve"})
+	})
+}
+
+func FuzzDecodeValue(f *testing.F) {
+	f.Add(`left = "LEFT"`)
+	f.Add(`{"left": "LEFT", "right": "RIGHT"}`)
+	f.Fuzz(func(t *testing.T, value string) {
+		if value == "-" || strings.HasPrefix(value, "@") {
+			t.Skip("reads from stdin or a file")
+		}
+		var dest mapperValue
+		scan := kong.Scan().PushTyped(value, kong.FlagValueToken)
+		_ = DecodeValue(&kong.DecodeContext{Scan: scan}, &dest)
+	})
+}
+
+func FuzzHCLFileMapper(f *testing.F) {
+	sample, err := ioutil.ReadFile("testdata/sample.hcl")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(sample)
+	dir, err := ioutil.TempDir("", "kong-hcl-fuzz-")
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "sample.hcl")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		var cli struct {
+			Sample TestSample `type:"hclfile"`
+		}
+		parser, err := kong.New(&cli, kong.NamedMapper("hclfile", HCLFileMapper), kong.Exit(func(int) {}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = parser.Parse([]string{"--sample", filename})
+	})
+}
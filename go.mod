@@ -4,7 +4,11 @@ go 1.14
 
 require (
 	github.com/alecthomas/kong v0.2.16
+	github.com/alecthomas/kong-hcl/core v0.1.0
 	github.com/hashicorp/hcl v1.0.0
 	github.com/pkg/errors v0.8.1
 	github.com/stretchr/testify v1.2.2
 )
+
+// Build against the core module in this repository; users of this module get the version required above.
+replace github.com/alecthomas/kong-hcl/core => ./core
@@ -4,38 +4,122 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
+	"strconv"
 	"strings"
 
 	"github.com/alecthomas/kong"
+	"github.com/alecthomas/kong-hcl/core"
 	"github.com/hashicorp/hcl"
-	"github.com/pkg/errors"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
 )
 
 // Resolver resolves kong Flags from configuration in HCL.
-type Resolver struct {
-	config map[string]interface{}
+type Resolver = core.Resolver
+
+// An Option configures how a Resolver is loaded.
+type Option = core.Option
+
+// ProfileFlag enables named configuration profiles, selected by the value of the given flag.
+//
+// See core.ProfileFlag for details.
+func ProfileFlag(flag string) Option {
+	return core.ProfileFlag(flag)
+}
+
+// AllowKeys permits configuration keys that do not correspond to any flag, and all keys below them.
+//
+// See core.AllowKeys for details.
+func AllowKeys(keys ...string) Option {
+	return core.AllowKeys(keys...)
+}
+
+// ValidationMode controls how problems found by Resolver.Validate are reported.
+type ValidationMode = core.ValidationMode
+
+// Validation modes.
+const (
+	// ValidateStrict fails validation on unknown keys. Other problems are reported as warnings.
+	ValidateStrict = core.ValidateStrict
+	// ValidateWarn reports all problems as warnings.
+	ValidateWarn = core.ValidateWarn
+	// ValidateIgnore does not report any problems.
+	ValidateIgnore = core.ValidateIgnore
+)
+
+// A Warning about configuration that does not prevent it from being used.
+type Warning = core.Warning
+
+// Validation sets the ValidationMode. The default is ValidateStrict.
+func Validation(mode ValidationMode) Option {
+	return core.Validation(mode)
+}
+
+// WarningHandler sets the function that configuration warnings are delivered to.
+//
+// The default writes warnings to os.Stderr.
+func WarningHandler(handler func(Warning)) Option {
+	return core.WarningHandler(handler)
+}
+
+// WarningWriter returns a warning handler that writes each warning to w on its own line.
+func WarningWriter(w io.Writer) func(Warning) {
+	return core.WarningWriter(w)
+}
+
+// DeprecatedKey permits the configuration key "key" as a deprecated spelling of "replacement".
+//
+// See core.DeprecatedKey for details.
+func DeprecatedKey(key, replacement string) Option {
+	return core.DeprecatedKey(key, replacement)
+}
+
+// KeyStyle is the style in which multi-word configuration keys are written.
+type KeyStyle = core.KeyStyle
+
+// Key styles.
+const (
+	// KebabCase keys are separated with hyphens, eg. "max-conns", matching kong flag names.
+	KebabCase = core.KebabCase
+	// SnakeCase keys are separated with underscores, eg. "max_conns", as is idiomatic in HCL.
+	SnakeCase = core.SnakeCase
+)
+
+// NormaliseKeys accepts configuration keys separated with either hyphens or underscores.
+//
+// See core.NormaliseKeys for details.
+func NormaliseKeys(style KeyStyle) Option {
+	return core.NormaliseKeys(style)
 }
 
 var _ kong.ConfigurationLoader = Loader
 
+// A DecodeOption configures how DecodeValue decodes values.
+type DecodeOption = core.DecodeOption
+
+// GuessFiles restores the original behaviour of DecodeValue, where a value is read as a file if a
+// file of that name exists, and is otherwise parsed as HCL. It is only provided for compatibility.
+func GuessFiles() DecodeOption {
+	return core.GuessFiles()
+}
+
 // DecodeValue decodes Kong values into a Go structure.
-func DecodeValue(ctx *kong.DecodeContext, dest interface{}) error {
+//
+// String values of the form "@path" are read from the file at path, "-" is read from stdin, and
+// any other string is parsed as HCL.
+func DecodeValue(ctx *kong.DecodeContext, dest interface{}, options ...DecodeOption) error {
 	v := ctx.Scan.Pop().Value
 	var (
-		data []byte
-		err  error
+		data     []byte
+		err      error
+		filename string
 	)
 	switch v := v.(type) {
 	case string:
-		// Value is a string; it can either be a filename or a HCL fragment.
-		filename := kong.ExpandPath(v)
-		data, err = ioutil.ReadFile(filename) // nolint: gosec
-		if os.IsNotExist(err) {
-			data = []byte(v)
-		} else if err != nil {
-			return errors.Wrapf(err, "invalid HCL in %q", filename)
+		filename, data, err = core.ReadSource(v, options...)
+		if err != nil {
+			return err
 		}
 	case []map[string]interface{}:
 		merged := map[string]interface{}{}
@@ -55,150 +139,141 @@ func DecodeValue(ctx *kong.DecodeContext, dest interface{}) error {
 			return err
 		}
 	}
-	return errors.Wrapf(hcl.Unmarshal(data, dest), "invalid HCL %q", data)
+	return unmarshal(filename, data, dest)
 }
 
 // Loader is a Kong configuration loader for HCL.
 func Loader(r io.Reader) (kong.Resolver, error) {
-	data, err := ioutil.ReadAll(r)
+	return NewLoader()(r)
+}
+
+// NewLoader creates a Kong configuration loader for HCL with the given options.
+func NewLoader(options ...Option) kong.ConfigurationLoader {
+	return core.NewLoader(parse, options...)
+}
+
+// NewResolver creates a Resolver from in-memory configuration.
+//
+// Keys and blocks are interpreted exactly as if they had been loaded from HCL, with nested maps
+// as blocks. Values may be nil, bools, strings, numbers, or slices and string-keyed maps of
+// those. Values of any other type are an error.
+func NewResolver(config map[string]interface{}, options ...Option) (*Resolver, error) {
+	tree, err := core.TreeFromMap(config)
 	if err != nil {
 		return nil, err
 	}
+	return core.New(tree, options...)
+}
+
+// Parse HCL (or JSON) into a configuration tree.
+//
+// HCL1 configuration can't read files, so fileAccess makes no difference.
+func parse(filename string, source []byte, fileAccess bool) (*core.Tree, error) {
 	config := map[string]interface{}{}
-	err = hcl.Unmarshal(data, &config)
+	file, err := decode(filename, source, &config)
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid HCL")
+		return nil, err
 	}
-	return &Resolver{config: config}, nil
-}
-
-func (r *Resolver) Validate(app *kong.Application) error { // nolint: golint
-	// Find all valid configuration keys from the Application.
-	valid := map[string]bool{}
-	rawPrefixes := []string{}
-	path := []string{}
-	_ = kong.Visit(app, func(node kong.Visitable, next kong.Next) error {
-		switch node := node.(type) {
-		case *kong.Node:
-			path = append(path, node.Name)
-			_ = next(nil)
-			path = path[:len(path)-1]
-			return nil
-
-		case *kong.Flag:
-			flagPath := append([]string{}, path...)
-			key := strings.Join(append(flagPath, node.Name), "-")
-			if _, ok := node.Target.Interface().(kong.MapperValue); ok {
-				rawPrefixes = append(rawPrefixes, key)
-			} else {
-				valid[key] = true
-			}
+	tree := core.NewTree(config)
+	recordPositions(tree, filename, nil, file.Node)
+	return tree, nil
+}
 
-		default:
-			return next(nil)
-		}
-		return nil
-	})
-	// Then check all configuration keys against the Application keys.
-next:
-	for key := range flattenConfig(valid, r.config) {
-		if !valid[key] {
-			for _, prefix := range rawPrefixes {
-				if strings.HasPrefix(key, prefix) {
-					continue next
+// Record the position of every key under node in the tree.
+func recordPositions(tree *core.Tree, filename string, path []string, node ast.Node) {
+	switch node := node.(type) {
+	case *ast.ObjectList:
+		for _, item := range node.Items {
+			itemPath := append([]string{}, path...)
+			for _, key := range item.Keys {
+				name, ok := key.Token.Value().(string)
+				if !ok {
+					break
 				}
+				itemPath = append(itemPath, name)
+				pos := key.Pos()
+				tree.SetPosition(itemPath, core.Position{Filename: filename, Line: pos.Line, Column: pos.Column})
 			}
-			return errors.Errorf("unknown configuration key %q", key)
+			recordPositions(tree, filename, itemPath, item.Val)
+		}
+	case *ast.ObjectType:
+		recordPositions(tree, filename, path, node.List)
+	case *ast.ListType:
+		for _, el := range node.List {
+			recordPositions(tree, filename, path, el)
 		}
 	}
-	return nil
-}
-
-func (r *Resolver) Resolve(context *kong.Context, parent *kong.Path, flag *kong.Flag) (interface{}, error) { // nolint: golint
-	path := r.pathForFlag(parent, flag)
-	return find(r.config, path)
 }
 
-// Build a string path up to this flag.
-func (r *Resolver) pathForFlag(parent *kong.Path, flag *kong.Flag) []string {
-	path := []string{}
-	for n := parent.Node(); n != nil && n.Type != kong.ApplicationNode; n = n.Parent {
-		path = append([]string{n.Name}, path...)
-	}
-	path = append(path, flag.Name)
-	return path
+// Unmarshal HCL or JSON.
+func unmarshal(filename string, data []byte, dest interface{}) error {
+	_, err := decode(filename, data, dest)
+	return err
 }
 
-// Find the value that path maps to.
-func find(config map[string]interface{}, path []string) (interface{}, error) {
-	if len(path) == 0 {
-		return config, nil
-	}
-
-	key := strings.Join(path, "-")
-	if sub := config[key]; sub != nil {
-		return sub, nil
-	}
-	parts := strings.SplitN(key, "-", -1)
-	for i := len(parts); i > 0; i-- {
-		prefix := strings.Join(parts[:i], "-")
-		if sub := config[prefix]; sub != nil {
-			if sub, ok := sub.([]map[string]interface{}); ok {
-				if len(sub) > 1 {
-					return sub, nil
-				}
-				return find(sub[0], parts[i:])
-			}
+// Parse HCL or JSON and decode it into dest.
+//
+// Errors are returned as *core.Diagnostics. Panics in the underlying parser are returned as
+// errors, so that malformed input can never crash the application.
+func decode(filename string, source []byte, dest interface{}) (file *ast.File, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			file = nil
+			err = core.NewDiagnostics(filename, source, core.Diagnostic{
+				Summary: "Invalid HCL",
+				Detail:  fmt.Sprintf("Failed to parse: %v.", r),
+			})
 		}
+	}()
+	file, err = hcl.ParseBytes(source)
+	if err != nil {
+		return nil, diagnose(filename, source, err)
 	}
-	return nil, nil
-}
-
-func flattenConfig(schema map[string]bool, config map[string]interface{}) map[string]bool {
-	out := map[string]bool{}
-next:
-	for _, path := range flattenNode(config) {
-		for i := len(path) - 1; i >= 0; i-- {
-			candidate := strings.Join(path[:i], "-")
-			if schema[candidate] {
-				out[candidate] = true
-				continue next
-			}
-		}
-		out[strings.Join(path, "-")] = true
+	if err := checkIntegers(filename, source, file.Node); err != nil {
+		return nil, err
+	}
+	if err := hcl.DecodeObject(dest, file); err != nil {
+		return nil, diagnose(filename, source, err)
 	}
-	return out
+	return file, nil
 }
 
-func flattenNode(config interface{}) [][]string {
-	out := [][]string{}
-	switch config := config.(type) {
-	case []map[string]interface{}:
-		for _, group := range config {
-			out = append(out, flattenNode(group)...)
-		}
-	case map[string]interface{}:
-		for key, value := range config {
-			children := flattenNode(value)
-			if len(children) == 0 {
-				out = append(out, []string{key})
-			} else {
-				for _, childValue := range children {
-					out = append(out, append([]string{key}, childValue...))
-				}
-			}
+// Report integer literals under node that HCL1 can't decode, as they don't fit in an int64.
+func checkIntegers(filename string, source []byte, node ast.Node) error {
+	diags := core.NewDiagnostics(filename, source)
+	ast.Walk(node, func(n ast.Node) (ast.Node, bool) {
+		literal, ok := n.(*ast.LiteralType)
+		if !ok || literal.Token.Type != token.NUMBER {
+			return n, true
 		}
-
-	case []interface{}:
-		for _, el := range config {
-			out = flattenNode(el)
+		_, err := strconv.ParseInt(literal.Token.Text, 0, 64)
+		if numErr, ok := err.(*strconv.NumError); !ok || numErr.Err != strconv.ErrRange {
+			return n, true
 		}
+		pos := literal.Token.Pos
+		diags.Diagnostics = append(diags.Diagnostics, core.Diagnostic{
+			Summary: "Integer out of range",
+			Detail:  fmt.Sprintf("%s does not fit in a 64-bit signed integer, the largest integer HCL1 supports.", literal.Token.Text),
+			Pos:     core.Position{Filename: filename, Line: pos.Line, Column: pos.Column},
+			End:     core.Position{Filename: filename, Line: pos.Line, Column: pos.Column + len(literal.Token.Text)},
+		})
+		return n, true
+	})
+	if len(diags.Diagnostics) > 0 {
+		return diags
+	}
+	return nil
+}
 
-	case bool, float64, int, string:
-		return nil
-
-	default:
-		panic(fmt.Sprintf("unsupported type %T", config))
+// Convert an error from the HCL parser or decoder into diagnostics.
+func diagnose(filename string, source []byte, err error) error {
+	diag := core.Diagnostic{Summary: "Invalid HCL", Detail: err.Error()}
+	if perr, ok := err.(*parser.PosError); ok {
+		diag.Detail = perr.Err.Error()
+		diag.Pos = core.Position{Filename: filename, Line: perr.Pos.Line, Column: perr.Pos.Column}
+	}
+	if diag.Detail != "" {
+		diag.Detail = strings.ToUpper(diag.Detail[:1]) + strings.TrimSuffix(diag.Detail[1:], ".") + "."
 	}
-	return out
+	return core.NewDiagnostics(filename, source, diag)
 }
@@ -2,11 +2,11 @@ package konghcl
 
 import (
 	"io/ioutil"
-	"os"
 	"reflect"
 
 	"github.com/alecthomas/kong"
-	"github.com/hashicorp/hcl"
+	"github.com/alecthomas/kong-hcl/core"
+	"github.com/pkg/errors"
 )
 
 // HCLFileMapper implements kong.MapperValue to decode an HCL file into
@@ -21,19 +21,72 @@ import (
 //    }
 var HCLFileMapper = kong.MapperFunc(decodeHCLFile) //hsnolint: gochecknoglobals
 
+// HCLFileDirMapper implements kong.MapperValue to decode each HCL file in a directory
+// into a map of structs, keyed by file name without extension.
+//
+//	var cli struct {
+//	  Jobs map[string]Job `type:"hclfiledir"`
+//	}
+//
+//	func main() {
+//	  kong.Parse(&cli, kong.NamedMapper("hclfiledir", konghcl.HCLFileDirMapper))
+//	}
+var HCLFileDirMapper = kong.MapperFunc(decodeHCLFileDir) //nolint: gochecknoglobals
+
 func decodeHCLFile(ctx *kong.DecodeContext, target reflect.Value) error {
-	var fname string
-	if err := ctx.Scan.PopValueInto("filename", &fname); err != nil {
+	var pattern string
+	if err := ctx.Scan.PopValueInto("filename", &pattern); err != nil {
+		return err
+	}
+	files, err := core.ExpandFiles(pattern)
+	if err != nil {
+		return err
+	}
+	for _, fname := range files {
+		// Each file is an element of a slice, or is decoded over the last, so later files
+		// override fields set by earlier ones.
+		if target.Kind() == reflect.Slice {
+			el := reflect.New(target.Type().Elem()).Elem()
+			if err := decodeFile(fname, el); err != nil {
+				return err
+			}
+			target.Set(reflect.Append(target, el))
+		} else if err := decodeFile(fname, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeHCLFileDir(ctx *kong.DecodeContext, target reflect.Value) error {
+	var dir string
+	if err := ctx.Scan.PopValueInto("directory", &dir); err != nil {
 		return err
 	}
-	f, err := os.Open(fname) //nolint:gosec
+	if target.Kind() != reflect.Map || target.Type().Key().Kind() != reflect.String {
+		return errors.Errorf("hclfiledir requires a map with string keys, not %s", target.Type())
+	}
+	keys, files, err := core.DirFiles(dir)
 	if err != nil {
 		return err
 	}
-	defer f.Close() //nolint
-	b, err := ioutil.ReadAll(f)
+	if target.IsNil() {
+		target.Set(reflect.MakeMap(target.Type()))
+	}
+	for _, key := range keys {
+		el := reflect.New(target.Type().Elem()).Elem()
+		if err := decodeFile(files[key], el); err != nil {
+			return err
+		}
+		target.SetMapIndex(reflect.ValueOf(key).Convert(target.Type().Key()), el)
+	}
+	return nil
+}
+
+func decodeFile(fname string, target reflect.Value) error {
+	b, err := ioutil.ReadFile(fname) //nolint:gosec
 	if err != nil {
 		return err
 	}
-	return hcl.Unmarshal(b, target.Addr().Interface())
+	return unmarshal(fname, b, target.Addr().Interface())
 }
@@ -45,3 +45,54 @@ func TestHCLFileMapperErr(t *testing.T) {
 	_, err = parser.Parse([]string{"--sample"})
 	require.Error(t, err)
 }
+
+func TestHCLFileMapperMerge(t *testing.T) {
+	var cli struct {
+		Sample TestSample `type:"hclfile"`
+	}
+	parser, err := kong.New(&cli, kong.NamedMapper("hclfile", HCLFileMapper))
+	require.NoError(t, err)
+
+	_, err = parser.Parse([]string{"--sample", "testdata/profiles/1-base.hcl", "--sample", "testdata/profiles/2-override.hcl"})
+	require.NoError(t, err)
+	require.Equal(t, TestSample{Name: "Lee Sedol", Game: "Baduk"}, cli.Sample)
+
+	_, err = parser.Parse([]string{"--sample", "testdata/profiles/*.hcl"})
+	require.NoError(t, err)
+	require.Equal(t, TestSample{Name: "Lee Sedol", Game: "Baduk"}, cli.Sample)
+
+	_, err = parser.Parse([]string{"--sample", "testdata/profiles/*.missing"})
+	require.EqualError(t, err, `--sample: no files match "testdata/profiles/*.missing"`)
+}
+
+func TestHCLFileMapperSlice(t *testing.T) {
+	var cli struct {
+		Samples []TestSample `type:"hclfile"`
+	}
+	parser, err := kong.New(&cli, kong.NamedMapper("hclfile", HCLFileMapper))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"--samples", "testdata/sample.hcl", "--samples", "testdata/profiles/1-base.hcl"})
+	require.NoError(t, err)
+	require.Equal(t, []TestSample{{Name: "Lee Sedol", Game: "Go"}, {Name: "Lee Sedol", Game: "Go"}}, cli.Samples)
+
+	_, err = parser.Parse([]string{"--samples", "testdata/jobs/*.hcl*"})
+	require.NoError(t, err)
+	require.Equal(t, []TestSample{{Name: "Build", Game: "Go"}, {Name: "Deploy", Game: "Chess"}}, cli.Samples)
+}
+
+func TestHCLFileDirMapper(t *testing.T) {
+	var cli struct {
+		Jobs map[string]TestSample `type:"hclfiledir"`
+	}
+	parser, err := kong.New(&cli, kong.NamedMapper("hclfiledir", HCLFileDirMapper))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"--jobs", "testdata/jobs"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]TestSample{
+		"build":  {Name: "Build", Game: "Go"},
+		"deploy": {Name: "Deploy", Game: "Chess"},
+	}, cli.Jobs)
+
+	_, err = parser.Parse([]string{"--jobs", "testdata/missing"})
+	require.Error(t, err)
+}
@@ -0,0 +1,2 @@
+name = "Build"
+game = "Go"
@@ -0,0 +1,2 @@
+name = "Lee Sedol"
+game = "Go"
@@ -0,0 +1,131 @@
+package konghcl
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurations(t *testing.T) {
+	type cli struct {
+		Timeout  time.Duration
+		Interval time.Duration `unit:"ms"`
+	}
+	parse := func(t *testing.T, config string) (*cli, error) {
+		t.Helper()
+		var cli cli
+		resolver, err := Loader(strings.NewReader(config))
+		require.NoError(t, err)
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse(nil)
+		return &cli, err
+	}
+
+	values, err := parse(t, `
+		timeout = "30s"
+		interval = 250
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, values.Timeout)
+	assert.Equal(t, 250*time.Millisecond, values.Interval)
+
+	_, err = parse(t, `timeout = 30`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `add a "unit" tag`)
+
+	t.Run("Exact", func(t *testing.T) {
+		var cli struct {
+			Timestamp time.Duration `unit:"ns"`
+		}
+		resolver, err := Loader(strings.NewReader(`timestamp = 1600000000000000001`))
+		require.NoError(t, err)
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse(nil)
+		require.NoError(t, err)
+		assert.Equal(t, time.Duration(1600000000000000001), cli.Timestamp)
+	})
+}
+
+func TestByteSize(t *testing.T) {
+	type cli struct {
+		MaxBody  ByteSize
+		MaxParts ByteSize `unit:"KiB"`
+		Quota    uint64   `type:"bytesize"`
+	}
+	parse := func(t *testing.T, config string, args ...string) (*cli, error) {
+		t.Helper()
+		var cli cli
+		resolver, err := Loader(strings.NewReader(config))
+		require.NoError(t, err)
+		parser, err := kong.New(&cli, kong.Resolvers(resolver), kong.NamedMapper("bytesize", ByteSizeMapper))
+		require.NoError(t, err)
+		_, err = parser.Parse(args)
+		return &cli, err
+	}
+
+	t.Run("FromResolver", func(t *testing.T) {
+		cli, err := parse(t, `
+			max-body = "10MiB"
+			max-parts = 4
+			quota = "1.5GB"
+		`)
+		require.NoError(t, err)
+		assert.Equal(t, ByteSize(10<<20), cli.MaxBody)
+		assert.Equal(t, ByteSize(4<<10), cli.MaxParts)
+		assert.Equal(t, uint64(1500000000), cli.Quota)
+	})
+
+	t.Run("FromFlag", func(t *testing.T) {
+		cli, err := parse(t, ``, "--max-body=2kb", "--max-parts=1", "--quota=512")
+		require.NoError(t, err)
+		assert.Equal(t, ByteSize(2000), cli.MaxBody)
+		assert.Equal(t, ByteSize(1024), cli.MaxParts)
+		assert.Equal(t, uint64(512), cli.Quota)
+	})
+
+	t.Run("Exact", func(t *testing.T) {
+		cli, err := parse(t, `
+			max-body = 9007199254740993
+			quota = 9007199254740995
+		`)
+		require.NoError(t, err)
+		assert.Equal(t, ByteSize(9007199254740993), cli.MaxBody)
+		assert.Equal(t, uint64(9007199254740995), cli.Quota)
+
+		cli, err = parse(t, `max-parts = 8796093022209`)
+		require.NoError(t, err)
+		assert.Equal(t, ByteSize(8796093022209<<10), cli.MaxParts)
+
+		_, err = parse(t, `max-parts = 9007199254740993`)
+		require.EqualError(t, err, "--max-parts: byte size 9223372036854776832 overflows core.ByteSize")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := parse(t, `max-body = "10 furlongs"`)
+		require.Error(t, err)
+		_, err = parse(t, `max-body = "1.5B"`)
+		require.Error(t, err)
+	})
+}
+
+func TestByteSizeString(t *testing.T) {
+	assert.Equal(t, "10MiB", ByteSize(10<<20).String())
+	assert.Equal(t, "1000B", ByteSize(1000).String())
+	assert.Equal(t, "0B", ByteSize(0).String())
+}
+
+func TestParseByteSize(t *testing.T) {
+	size, err := ParseByteSize("1.5 KiB")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1536), size)
+	_, err = ParseByteSize("KiB")
+	require.Error(t, err)
+	_, err = ParseByteSize("-5MB")
+	require.EqualError(t, err, `invalid byte size "-5MB": byte sizes can't be negative`)
+}
@@ -0,0 +1,341 @@
+package konghcl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/alecthomas/kong-hcl/core"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/pkg/errors"
+)
+
+// Fix renames unknown keys in the configuration in source to the closest keys of flags in app,
+// returning the fixed source and a diagnostic for each unknown key that could not be fixed.
+//
+// An unknown key is only renamed if exactly one key within its enclosing block is the closest
+// to it, and the key it would be renamed to is neither set anywhere in the file, nor the
+// closest key to another unknown key. Within a profile, only the profile is considered. Blocks
+// are renamed to the closest prefix of the keys of flags, eg. "dbb { dsn = ... }" to
+// "db { dsn = ... }", unless a key in them is already set. The rest of the configuration,
+// including its comments and formatting, is unchanged. JSON configuration is an error.
+func Fix(app *kong.Application, filename string, source []byte, options ...Option) ([]byte, []core.Diagnostic, error) {
+	return fix(core.NewLayout(app, options...), filename, source)
+}
+
+// FixConfig can be added as a flag to fix unknown keys in configuration files and exit.
+//
+// Every file passed to Configuration is fixed with Fix, using the options of its loader, and
+// the changes are printed as a unified diff. Unknown keys that could not be fixed are reported,
+// in which case the exit status is non-zero. JSON files are left as they are.
+type FixConfig bool
+
+func (f FixConfig) BeforeResolve(app *kong.Kong, files ConfigFiles) error { // nolint: golint
+	unfixed := &core.Diagnostics{Sources: map[string][]byte{}}
+	for _, path := range files.Paths {
+		path = kong.ExpandPath(path)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		source, err := ioutil.ReadFile(path) // nolint: gosec
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if isJSON(path, source) {
+			continue
+		}
+		resolver, err := load(files.Loader, path)
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+		r, ok := resolver.(*Resolver)
+		if !ok {
+			return errors.Errorf("%s: can't fix configuration loaded by %T", path, resolver)
+		}
+		fixed, diagnostics, err := fix(r.Layout(app.Model), path, source)
+		if err != nil {
+			return err
+		}
+		unfixed.Sources[path] = source
+		unfixed.Diagnostics = append(unfixed.Diagnostics, diagnostics...)
+		if diff := core.UnifiedDiff(path, source, fixed); diff != "" {
+			fmt.Fprint(app.Stdout, diff)
+			if err := ioutil.WriteFile(path, fixed, info.Mode()); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	status := 0
+	if len(unfixed.Diagnostics) > 0 {
+		_ = unfixed.Write(app.Stderr, core.IsTerminal(app.Stderr))
+		status = 1
+	}
+	app.Exit(status)
+	return nil
+}
+
+func fix(layout *core.Layout, filename string, source []byte) ([]byte, []core.Diagnostic, error) {
+	if isJSON(filename, source) {
+		return nil, nil, errors.Errorf("%s: JSON configuration can't be fixed", filename)
+	}
+	file, diags := parseWritable(source, filename)
+	if diags.HasErrors() {
+		return nil, nil, diagnostics(filename, source, diags)
+	}
+	f := &fixer{layout: layout, filename: filename, positions: tokenPositions(file.BuildTokens(nil)), decided: map[*hclwrite.Token]bool{}}
+	f.body(file.Body(), true)
+	sort.SliceStable(f.unfixed, func(i, j int) bool {
+		a, b := f.unfixed[i].Pos, f.unfixed[j].Pos
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	// File.Bytes reformats the file, so write its tokens as they are.
+	out := &bytes.Buffer{}
+	if _, err := file.BuildTokens(nil).WriteTo(out); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	return out.Bytes(), f.unfixed, nil
+}
+
+type fixer struct {
+	layout    *core.Layout
+	filename  string
+	positions map[*hclwrite.Token]hcl.Pos
+	unfixed   []core.Diagnostic
+	// Unknown keys that have been renamed or reported.
+	decided map[*hclwrite.Token]bool
+}
+
+// An unknown key that may be renamed.
+type candidate struct {
+	token *hclwrite.Token
+	// Path to the key as it is written.
+	path  []string
+	block *hclwrite.Block
+	// The names the key may be renamed to, and if there is one, the canonical key it would
+	// then have.
+	suggestions []string
+	target      string
+	// For blocks, the keys in the block that would be set if it were renamed, and the names
+	// they are written with.
+	keys map[string]string
+}
+
+// Fix the keys of a body, along with those of any profiles in it if top is true.
+//
+// Blocks are renamed in rounds, as renaming a block may reveal unknown keys inside it, and
+// attributes once no more blocks are. A key is left alone if a key it would set is already set
+// anywhere in the body, or if other unknown keys would set it too.
+func (f *fixer) body(body *hclwrite.Body, top bool) {
+	for {
+		set := map[string]bool{}
+		candidates := []*candidate{}
+		profiles := f.collect(body, nil, top, set, &candidates)
+		claims := map[string]int{}
+		for _, c := range candidates {
+			f.suggest(c)
+			if len(c.suggestions) != 1 {
+				continue
+			}
+			claims[c.target]++
+			for key := range c.keys {
+				claims[key]++
+			}
+		}
+		// Attributes are left until no more blocks are renamed, so that they compete with
+		// those in renamed blocks.
+		renamedBlock := false
+		for _, c := range candidates {
+			if c.block != nil {
+				f.decided[c.token] = true
+				renamedBlock = f.decide(c, set, claims, candidates) || renamedBlock
+			}
+		}
+		if renamedBlock {
+			continue
+		}
+		for _, c := range candidates {
+			if c.block == nil {
+				f.decided[c.token] = true
+				f.decide(c, set, claims, candidates)
+			}
+		}
+		for _, profile := range profiles {
+			f.body(profile, false)
+		}
+		return
+	}
+}
+
+// Collect the keys set in body, which is at path, into set, and its undecided unknown keys into
+// candidates, returning the bodies of any profiles if top is true.
+func (f *fixer) collect(body *hclwrite.Body, path []string, top bool, set map[string]bool, candidates *[]*candidate) []*hclwrite.Body {
+	attrs := body.Attributes()
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, value := splitComments(attrs[name].BuildTokens(nil))
+		attrPath := append(append([]string{}, path...), name)
+		if key, kind := f.layout.Classify(attrPath); kind == core.KeyFlag {
+			set[key] = true
+		} else if f.layout.IsUnknown(attrPath) && !f.decided[value[0]] && candidates != nil {
+			*candidates = append(*candidates, &candidate{token: value[0], path: attrPath})
+		}
+	}
+
+	profiles := []*hclwrite.Body{}
+	for _, block := range body.Blocks() {
+		_, value := splitComments(block.BuildTokens(nil))
+		switch {
+		case top && block.Type() == localsBlock:
+			continue
+		case top && block.Type() == f.layout.ProfileBlock() && len(block.Labels()) == 1:
+			profiles = append(profiles, block.Body())
+			continue
+		case len(block.Labels()) > 0:
+			continue
+		}
+		blockPath := append(append([]string{}, path...), block.Type())
+		if f.layout.IsUnknown(blockPath) {
+			if !f.decided[value[0]] && candidates != nil {
+				*candidates = append(*candidates, &candidate{token: value[0], path: blockPath, block: block})
+			}
+			continue
+		}
+		switch key, kind := f.layout.Classify(blockPath); kind {
+		case core.KeyFlag:
+			set[key] = true
+		case core.KeyPrefix:
+			f.collect(block.Body(), blockPath, false, set, candidates)
+		}
+	}
+	return profiles
+}
+
+// Find the names that the key of c may be renamed to, and what it would then set.
+func (f *fixer) suggest(c *candidate) {
+	c.suggestions = f.layout.Suggest(c.path, c.block != nil)
+	if len(c.suggestions) != 1 {
+		return
+	}
+	renamed := append(append([]string{}, c.path[:len(c.path)-1]...), c.suggestions[0])
+	c.target, _ = f.layout.Classify(renamed)
+	if c.block == nil {
+		return
+	}
+	inner := map[string]bool{}
+	f.collect(c.block.Body(), renamed, false, inner, nil)
+	c.keys = map[string]string{}
+	for key := range inner {
+		c.keys[key] = strings.TrimPrefix(key, c.target+"-")
+	}
+}
+
+// Rename the key of c if that is safe, or report why it was not, returning true if it was renamed.
+func (f *fixer) decide(c *candidate, set map[string]bool, claims map[string]int, candidates []*candidate) bool {
+	name := c.path[len(c.path)-1]
+	pos := f.positions[c.token]
+	diag := core.Diagnostic{
+		Rule:    core.RuleUnknownKey,
+		Summary: "Unknown configuration key",
+		Pos:     core.Position{Filename: f.filename, Line: pos.Line, Column: pos.Column},
+		End:     core.Position{Filename: f.filename, Line: pos.Line, Column: pos.Column + len(c.token.Bytes)},
+	}
+	switch {
+	case len(c.suggestions) == 0:
+		diag.Detail = fmt.Sprintf("No key is close to %q, so it was not changed.", name)
+	case len(c.suggestions) > 1:
+		diag.Summary = "Ambiguous configuration key"
+		diag.Detail = fmt.Sprintf("%q is equally close to %s, so it was not changed.", name, core.QuoteList(c.suggestions))
+	case c.block == nil && set[c.target]:
+		diag.Detail = fmt.Sprintf("%q is closest to %q, which is already set, so it was not changed.", name, c.suggestions[0])
+	case len(c.conflicts(set)) > 0:
+		diag.Detail = fmt.Sprintf("%q is closest to %q, which already sets %s, so it was not changed.", name, c.suggestions[0], strings.Join(c.conflicts(set), " and "))
+	case f.competing(c, claims):
+		others := []string{}
+		for _, other := range candidates {
+			if other != c && len(other.suggestions) == 1 && f.overlaps(c, other) {
+				others = append(others, fmt.Sprintf("%q on line %d", other.path[len(other.path)-1], f.positions[other.token].Line))
+			}
+		}
+		diag.Detail = fmt.Sprintf("%q is closest to %q, as is %s, so it was not changed.", name, c.suggestions[0], strings.Join(others, " and "))
+	default:
+		c.token.Bytes = []byte(c.suggestions[0])
+		return true
+	}
+	f.unfixed = append(f.unfixed, diag)
+	return false
+}
+
+// Returns true if another candidate would set any key that c would.
+func (f *fixer) competing(c *candidate, claims map[string]int) bool {
+	if len(c.suggestions) != 1 {
+		return false
+	}
+	if claims[c.target] > 1 {
+		return true
+	}
+	for key := range c.keys {
+		if claims[key] > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if candidates a and b would set any of the same keys.
+func (f *fixer) overlaps(a, b *candidate) bool {
+	keys := func(c *candidate) map[string]bool {
+		out := map[string]bool{c.target: true}
+		for key := range c.keys {
+			out[key] = true
+		}
+		return out
+	}
+	bk := keys(b)
+	for key := range keys(a) {
+		if bk[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// The quoted names of the keys in the block of c that are already set.
+func (c *candidate) conflicts(set map[string]bool) []string {
+	out := []string{}
+	for key, name := range c.keys {
+		if set[key] {
+			out = append(out, fmt.Sprintf("%q", name))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// The starting position of each token.
+func tokenPositions(tokens hclwrite.Tokens) map[*hclwrite.Token]hcl.Pos {
+	positions := map[*hclwrite.Token]hcl.Pos{}
+	pos := hcl.Pos{Line: 1, Column: 1}
+	for _, token := range tokens {
+		pos.Column += token.SpacesBefore
+		positions[token] = pos
+		for _, r := range string(token.Bytes) {
+			if r == '\n' {
+				pos.Line++
+				pos.Column = 1
+			} else {
+				pos.Column++
+			}
+		}
+	}
+	return positions
+}
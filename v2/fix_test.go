@@ -0,0 +1,183 @@
+package konghcl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/alecthomas/kong-hcl/core"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFix(t *testing.T) {
+	var cli struct {
+		Port  int
+		Host  string
+		Hosts []string
+		Sort  bool
+		DB    struct {
+			DSN   string
+			Trace bool
+		} `embed:"" prefix:"db-"`
+	}
+	parser, err := kong.New(&cli)
+	require.NoError(t, err)
+
+	source := `# The port.
+prot = 8080 # Keep this.
+hostt = "localhost"
+unrelated = true
+dbb {
+  # Connection string.
+  dns = "root@/database"
+}
+db {
+  trace = true
+  dns = "other@/database"
+}
+`
+	fixed, unfixed, err := Fix(parser.Model, "config.hcl", []byte(source))
+	require.NoError(t, err)
+	require.Equal(t, `# The port.
+port = 8080 # Keep this.
+hostt = "localhost"
+unrelated = true
+db {
+  # Connection string.
+  dns = "root@/database"
+}
+db {
+  trace = true
+  dns = "other@/database"
+}
+`, string(fixed))
+	require.Equal(t, []core.Diagnostic{
+		{
+			Rule:    core.RuleUnknownKey,
+			Summary: "Ambiguous configuration key",
+			Detail:  `"hostt" is equally close to "host" or "hosts", so it was not changed.`,
+			Pos:     core.Position{Filename: "config.hcl", Line: 3, Column: 1},
+			End:     core.Position{Filename: "config.hcl", Line: 3, Column: 6},
+		},
+		{
+			Rule:    core.RuleUnknownKey,
+			Summary: "Unknown configuration key",
+			Detail:  `No key is close to "unrelated", so it was not changed.`,
+			Pos:     core.Position{Filename: "config.hcl", Line: 4, Column: 1},
+			End:     core.Position{Filename: "config.hcl", Line: 4, Column: 10},
+		},
+		{
+			Rule:    core.RuleUnknownKey,
+			Summary: "Unknown configuration key",
+			Detail:  `"dns" is closest to "dsn", as is "dns" on line 11, so it was not changed.`,
+			Pos:     core.Position{Filename: "config.hcl", Line: 7, Column: 3},
+			End:     core.Position{Filename: "config.hcl", Line: 7, Column: 6},
+		},
+		{
+			Rule:    core.RuleUnknownKey,
+			Summary: "Unknown configuration key",
+			Detail:  `"dns" is closest to "dsn", as is "dns" on line 7, so it was not changed.`,
+			Pos:     core.Position{Filename: "config.hcl", Line: 11, Column: 3},
+			End:     core.Position{Filename: "config.hcl", Line: 11, Column: 6},
+		},
+	}, unfixed)
+}
+
+func TestFixConflicts(t *testing.T) {
+	var cli struct {
+		Port int
+		DB   struct {
+			DSN   string
+			Trace bool
+		} `embed:"" prefix:"db-"`
+	}
+	parser, err := kong.New(&cli)
+	require.NoError(t, err)
+
+	source := `db {
+  dsn = "a"
+}
+db-dsnn = "b"
+prot = 1
+pory = 2
+dbb {
+  dsn = "c"
+}
+profile "dev" {
+  db-dsnn = "d"
+}
+`
+	fixed, unfixed, err := Fix(parser.Model, "config.hcl", []byte(source), ProfileFlag("profile"))
+	require.NoError(t, err)
+	require.Equal(t, source[:len(source)-len("db-dsnn = \"d\"\n}\n")]+"db-dsn = \"d\"\n}\n", string(fixed))
+	require.Equal(t, []core.Diagnostic{
+		{
+			Rule:    core.RuleUnknownKey,
+			Summary: "Unknown configuration key",
+			Detail:  `"db-dsnn" is closest to "db-dsn", which is already set, so it was not changed.`,
+			Pos:     core.Position{Filename: "config.hcl", Line: 4, Column: 1},
+			End:     core.Position{Filename: "config.hcl", Line: 4, Column: 8},
+		},
+		{
+			Rule:    core.RuleUnknownKey,
+			Summary: "Unknown configuration key",
+			Detail:  `"prot" is closest to "port", as is "pory" on line 6, so it was not changed.`,
+			Pos:     core.Position{Filename: "config.hcl", Line: 5, Column: 1},
+			End:     core.Position{Filename: "config.hcl", Line: 5, Column: 5},
+		},
+		{
+			Rule:    core.RuleUnknownKey,
+			Summary: "Unknown configuration key",
+			Detail:  `"pory" is closest to "port", as is "prot" on line 5, so it was not changed.`,
+			Pos:     core.Position{Filename: "config.hcl", Line: 6, Column: 1},
+			End:     core.Position{Filename: "config.hcl", Line: 6, Column: 5},
+		},
+		{
+			Rule:    core.RuleUnknownKey,
+			Summary: "Unknown configuration key",
+			Detail:  `"dbb" is closest to "db", which already sets "dsn", so it was not changed.`,
+			Pos:     core.Position{Filename: "config.hcl", Line: 7, Column: 1},
+			End:     core.Position{Filename: "config.hcl", Line: 7, Column: 4},
+		},
+	}, unfixed)
+}
+
+func TestFixConfig(t *testing.T) {
+	var cli struct {
+		Port      int
+		FixConfig FixConfig
+	}
+	dir, err := ioutil.TempDir("", "kong-hcl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.hcl")
+	require.NoError(t, ioutil.WriteFile(path, []byte("prot = 8080\n"), 0600))
+	jsonPath := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(jsonPath, []byte(`{"port": 8080}`), 0600))
+	stdout := &strings.Builder{}
+	status := -1
+	parser, err := kong.New(&cli,
+		Configuration(Loader, path, jsonPath),
+		kong.Writers(stdout, ioutil.Discard),
+		kong.Exit(func(code int) {
+			if status == -1 {
+				status = code
+			}
+		}))
+	require.NoError(t, err)
+	_, _ = parser.Parse([]string{"--fix-config"})
+	require.Equal(t, 0, status)
+	require.Equal(t, "--- "+path+"\n+++ "+path+"\n@@ -1 +1 @@\n-prot = 8080\n+port = 8080\n", stdout.String())
+	fixed, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "port = 8080\n", string(fixed))
+	fixed, err = ioutil.ReadFile(jsonPath)
+	require.NoError(t, err)
+	require.Equal(t, `{"port": 8080}`, string(fixed))
+
+	_, _, err = Fix(parser.Model, "config.json", []byte(`{"prot": 8080}`))
+	require.EqualError(t, err, "config.json: JSON configuration can't be fixed")
+}
@@ -0,0 +1,496 @@
+package konghcl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/alecthomas/kong"
+	"github.com/alecthomas/kong-hcl/core"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/pkg/errors"
+)
+
+// Format rewrites the configuration in source into a canonical form for app, keeping comments
+// with the attributes and blocks they precede.
+//
+// Keys are written as by DumpConfig: keys that share their first hyphen-separated segment with
+// other keys are grouped into a block named after it, and the remaining keys are written flat,
+// each in alphabetical order. Both "db-dsn = ..." and "db { dsn = ... }" are rewritten to the
+// canonical form, deprecated keys registered with DeprecatedKey are replaced with their new
+// keys, and keys are written in the KeyStyle of any NormaliseKeys option.
+//
+// Attributes and blocks that do not configure any flag, labelled blocks, and blocks containing
+// either, are kept as they are, after the canonical keys. Top-level attributes referenced by
+// other attributes are written flat under their own names, so that the references still resolve.
+// The bodies of profiles are formatted in the same way as the top level. A key set to different
+// values flat and in a block, and JSON configuration, are errors.
+func Format(app *kong.Application, filename string, source []byte, options ...Option) ([]byte, error) {
+	return format(core.NewLayout(app, options...), filename, source)
+}
+
+// FormatConfig can be added as a flag to rewrite configuration files in canonical form and exit.
+//
+// Every file passed to Configuration is formatted with Format, using the options of its loader,
+// and the name of each file that changed is printed. JSON files are left as they are.
+type FormatConfig bool
+
+func (f FormatConfig) BeforeResolve(app *kong.Kong, files ConfigFiles) error { // nolint: golint
+	for _, path := range files.Paths {
+		path = kong.ExpandPath(path)
+		source, err := ioutil.ReadFile(path) // nolint: gosec
+		if err != nil || isJSON(path, source) {
+			continue
+		}
+		resolver, err := load(files.Loader, path)
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+		r, ok := resolver.(*Resolver)
+		if !ok {
+			return errors.Errorf("%s: can't format configuration loaded by %T", path, resolver)
+		}
+		formatted, err := format(r.Layout(app.Model), path, source)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(formatted, source) {
+			continue
+		}
+		if err := ioutil.WriteFile(path, formatted, 0600); err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintln(app.Stdout, path)
+	}
+	app.Exit(0)
+	return nil
+}
+
+// Load the file at path with loader.
+func load(loader kong.ConfigurationLoader, path string) (kong.Resolver, error) {
+	r, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer r.Close()
+	return loader(r)
+}
+
+func format(layout *core.Layout, filename string, source []byte) ([]byte, error) {
+	if isJSON(filename, source) {
+		return nil, errors.Errorf("%s: JSON configuration can't be formatted", filename)
+	}
+	file, diags := parseWritable(source, filename)
+	if diags.HasErrors() {
+		return nil, diagnostics(filename, source, diags)
+	}
+	syntax, diags := hclsyntax.ParseConfig(source, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diagnostics(filename, source, diags)
+	}
+	f := &formatter{layout: layout, referenced: referencedAttributes(syntax.Body.(*hclsyntax.Body)), conflicts: map[string]bool{}}
+	formatted := hclwrite.Format(f.body(file.Body(), true).Bytes())
+	// Refuse to drop one of two different values for a key, rather than guess which was meant.
+	if len(f.conflicts) > 0 {
+		keys := make([]string, 0, len(f.conflicts))
+		for key := range f.conflicts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return nil, errors.Errorf("%s: can't format configuration, as %q is set to different values flat and in a block", filename, keys[0])
+	}
+	if len(f.referenced) == 0 {
+		return formatted, nil
+	}
+	// Refuse to drop a referenced attribute, such as one overridden by a deprecated key.
+	syntax, diags = hclsyntax.ParseConfig(formatted, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diagnostics(filename, formatted, diags)
+	}
+	names := make([]string, 0, len(f.referenced))
+	for name := range f.referenced {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := syntax.Body.(*hclsyntax.Body).Attributes[name]; !ok {
+			return nil, errors.Errorf("%s: can't format configuration, as it would remove %q, which other attributes refer to", filename, name)
+		}
+	}
+	return formatted, nil
+}
+
+// Parse HCL source for rewriting.
+//
+// As with parse, panics in the underlying parser are returned as diagnostics.
+func parseWritable(source []byte, filename string) (file *hclwrite.File, diags hcl.Diagnostics) {
+	defer func() {
+		if r := recover(); r != nil {
+			file = nil
+			diags = hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid configuration",
+				Detail:   fmt.Sprintf("Failed to parse %s: %v.", filename, r),
+			}}
+		}
+	}()
+	return hclwrite.ParseConfig(source, filename, hcl.Pos{Line: 1, Column: 1})
+}
+
+// The names of the top-level attributes of body that are referenced by any attribute in it.
+func referencedAttributes(body *hclsyntax.Body) map[string]bool {
+	referenced := map[string]bool{}
+	var walk func(inner *hclsyntax.Body)
+	walk = func(inner *hclsyntax.Body) {
+		for _, attr := range inner.Attributes {
+			for _, traversal := range attr.Expr.Variables() {
+				if _, ok := body.Attributes[traversal.RootName()]; ok {
+					referenced[traversal.RootName()] = true
+				}
+			}
+		}
+		for _, block := range inner.Blocks {
+			walk(block.Body)
+		}
+	}
+	walk(body)
+	return referenced
+}
+
+type formatter struct {
+	layout *core.Layout
+	// Top-level attributes that are referenced by name.
+	referenced map[string]bool
+	// Keys set to different values at different depths.
+	conflicts map[string]bool
+}
+
+// An attribute or block in a body.
+type item struct {
+	attr  *hclwrite.Attribute
+	block *hclwrite.Block
+	// Comments on the lines directly before the item that hclwrite does not attach to it.
+	lead hclwrite.Tokens
+}
+
+func (i item) tokens() hclwrite.Tokens {
+	if i.attr != nil {
+		return i.attr.BuildTokens(nil)
+	}
+	return i.block.BuildTokens(nil)
+}
+
+// A key configuring a flag, and its value.
+type entry struct {
+	key string
+	// The attribute or block setting the key, from its name onwards.
+	value hclwrite.Tokens
+	// Comments preceding the attribute or block, and any blocks that it was moved out of.
+	comments hclwrite.Tokens
+	// Values in enclosing blocks are overridden by values closer to the top level.
+	depth int
+	// Referenced entries are written flat, under the name they were found with.
+	referenced bool
+}
+
+// The canonical keys of a body, and everything that is kept as it is.
+type collected struct {
+	entries map[string]*entry
+	// Entries in the order they were found.
+	order    []*entry
+	comments hclwrite.Tokens
+	locals   []hclwrite.Tokens
+	attrs    []hclwrite.Tokens
+	blocks   []hclwrite.Tokens
+}
+
+// Format a body, which is at the top level if top is true.
+func (f *formatter) body(body *hclwrite.Body, top bool) hclwrite.Tokens {
+	c := &collected{entries: map[string]*entry{}}
+	items, comments := bodyItems(body)
+	c.comments = comments
+	for _, item := range items {
+		f.collect(c, item, nil, top)
+	}
+
+	out := hclwrite.Tokens{}
+	out = appendComments(out, c.comments)
+	if len(out) > 0 {
+		out = appendNewline(out)
+	}
+	for _, locals := range c.locals {
+		out = appendNewline(appendLines(out, locals))
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	groups := map[string][]*entry{}
+	groupNames := []string{}
+	for _, key := range keys {
+		e := c.entries[key]
+		block, name := f.layout.Place(key)
+		if e.referenced {
+			block, name = "", itemName(e.value)
+		}
+		if block == "" {
+			out = appendComments(out, e.comments)
+			out = appendLines(out, renamed(e.value, name))
+			continue
+		}
+		if groups[block] == nil {
+			groupNames = append(groupNames, block)
+		}
+		groups[block] = append(groups[block], e)
+	}
+	for _, attr := range c.attrs {
+		out = appendLines(out, attr)
+	}
+	sort.Strings(groupNames)
+	for _, block := range groupNames {
+		if len(out) > 0 {
+			out = appendNewline(out)
+		}
+		entries := groups[block]
+		for _, e := range entries {
+			out = appendComments(out, e.comments)
+		}
+		out = append(out, &hclwrite.Token{Type: hclsyntax.TokenIdent, Bytes: []byte(block)},
+			&hclwrite.Token{Type: hclsyntax.TokenOBrace, Bytes: []byte("{"), SpacesBefore: 1})
+		out = appendNewline(out)
+		for _, e := range entries {
+			_, name := f.layout.Place(e.key)
+			out = appendLines(out, renamed(e.value, name))
+		}
+		out = append(out, &hclwrite.Token{Type: hclsyntax.TokenCBrace, Bytes: []byte("}")})
+		out = appendNewline(out)
+	}
+	for _, block := range c.blocks {
+		if len(out) > 0 {
+			out = appendNewline(out)
+		}
+		out = appendLines(out, block)
+	}
+	return out
+}
+
+// Collect an item found in the blocks "prefix" of a body into c.
+func (f *formatter) collect(c *collected, item item, prefix []string, top bool) {
+	comments, value := splitComments(item.tokens())
+	comments = append(append(hclwrite.Tokens{}, item.lead...), comments...)
+	if item.attr != nil {
+		key, kind := f.layout.Classify(append(prefix, itemName(value)))
+		if kind != core.KeyFlag {
+			c.attrs = append(c.attrs, append(comments, value...))
+			return
+		}
+		referenced := top && f.referenced[itemName(value)]
+		f.add(c, &entry{key: key, value: value, comments: comments, depth: len(prefix), referenced: referenced})
+		return
+	}
+
+	block := item.block
+	switch {
+	case top && block.Type() == localsBlock && len(block.Labels()) == 0:
+		c.locals = append(c.locals, append(comments, value...))
+		return
+
+	case top && block.Type() == f.layout.ProfileBlock() && len(block.Labels()) == 1:
+		c.blocks = append(c.blocks, append(comments, f.rebuildBlock(value, f.body(block.Body(), false))...))
+		return
+
+	case len(block.Labels()) > 0:
+		c.blocks = append(c.blocks, append(comments, value...))
+		return
+	}
+
+	path := append(append([]string{}, prefix...), block.Type())
+	key, kind := f.layout.Classify(path)
+	switch {
+	case kind == core.KeyFlag:
+		f.add(c, &entry{key: key, value: value, comments: comments, depth: len(prefix)})
+
+	case kind == core.KeyPrefix && f.canonical(block, path):
+		items, inner := bodyItems(block.Body())
+		before := len(c.order)
+		for _, item := range items {
+			f.collect(c, item, path, false)
+		}
+		// Comments on the block are kept with the first of its keys.
+		comments = append(comments, inner...)
+		if len(c.order) > before {
+			first := c.order[before]
+			first.comments = append(comments, first.comments...)
+		} else {
+			c.comments = append(c.comments, comments...)
+		}
+
+	default:
+		c.blocks = append(c.blocks, append(comments, value...))
+	}
+}
+
+// Add an entry to c, unless it is overridden by an existing entry for the same key.
+//
+// Only one value is kept for each key, but the comments of both are. A key set to different
+// values at different depths is recorded as a conflict.
+func (f *formatter) add(c *collected, e *entry) {
+	c.order = append(c.order, e)
+	existing, ok := c.entries[e.key]
+	if !ok {
+		c.entries[e.key] = e
+		return
+	}
+	if existing.depth != e.depth && !bytes.Equal(valueBytes(existing.value), valueBytes(e.value)) {
+		f.conflicts[e.key] = true
+	}
+	if existing.depth < e.depth {
+		existing.comments = append(existing.comments, e.comments...)
+		return
+	}
+	e.comments = append(existing.comments, e.comments...)
+	c.entries[e.key] = e
+}
+
+// Returns true if every attribute and block in block, which is at path, configures a flag.
+func (f *formatter) canonical(block *hclwrite.Block, path []string) bool {
+	items, _ := bodyItems(block.Body())
+	for _, item := range items {
+		if item.attr != nil {
+			_, value := splitComments(item.tokens())
+			if _, kind := f.layout.Classify(append(path, itemName(value))); kind != core.KeyFlag {
+				return false
+			}
+			continue
+		}
+		if len(item.block.Labels()) > 0 {
+			return false
+		}
+		nested := append(append([]string{}, path...), item.block.Type())
+		switch _, kind := f.layout.Classify(nested); kind {
+		case core.KeyFlag:
+		case core.KeyPrefix:
+			if !f.canonical(item.block, nested) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Rebuild the tokens of a block with a new body.
+func (f *formatter) rebuildBlock(block hclwrite.Tokens, body hclwrite.Tokens) hclwrite.Tokens {
+	out := hclwrite.Tokens{}
+	for _, token := range block {
+		out = append(out, token)
+		if token.Type == hclsyntax.TokenOBrace {
+			break
+		}
+	}
+	out = appendNewline(out)
+	out = appendLines(out, body)
+	out = append(out, &hclwrite.Token{Type: hclsyntax.TokenCBrace, Bytes: []byte("}")})
+	return appendNewline(out)
+}
+
+// The attributes and blocks of body in source order, and the comments that are not attached to
+// either.
+func bodyItems(body *hclwrite.Body) ([]item, hclwrite.Tokens) {
+	starts := map[*hclwrite.Token]item{}
+	for _, attr := range body.Attributes() {
+		starts[attr.BuildTokens(nil)[0]] = item{attr: attr}
+	}
+	for _, block := range body.Blocks() {
+		starts[block.BuildTokens(nil)[0]] = item{block: block}
+	}
+	items := []item{}
+	comments := hclwrite.Tokens{}
+	// Comments that will be attached to the next item unless a blank line follows them.
+	pending := hclwrite.Tokens{}
+	tokens := body.BuildTokens(nil)
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch item, ok := starts[token]; {
+		case ok:
+			item.lead = pending
+			pending = hclwrite.Tokens{}
+			items = append(items, item)
+			i += len(item.tokens()) - 1
+
+		case token.Type == hclsyntax.TokenComment:
+			pending = append(pending, token)
+
+		case token.Type == hclsyntax.TokenNewline && (i == 0 || endsLine(tokens[i-1])):
+			comments = append(comments, pending...)
+			pending = hclwrite.Tokens{}
+		}
+	}
+	return items, append(comments, pending...)
+}
+
+// Split the tokens of an attribute or block into its leading comments and the rest.
+func splitComments(tokens hclwrite.Tokens) (hclwrite.Tokens, hclwrite.Tokens) {
+	for i, token := range tokens {
+		if token.Type != hclsyntax.TokenComment {
+			return tokens[:i], tokens[i:]
+		}
+	}
+	return tokens, nil
+}
+
+// The name of an attribute or type of a block, from its tokens without leading comments.
+func itemName(value hclwrite.Tokens) string {
+	return string(value[0].Bytes)
+}
+
+// The value of an attribute or the body of a block, without its name, comments or layout.
+func valueBytes(value hclwrite.Tokens) []byte {
+	out := []byte{}
+	for _, token := range value[1:] {
+		if token.Type != hclsyntax.TokenComment && token.Type != hclsyntax.TokenNewline {
+			out = append(out, token.Bytes...)
+		}
+	}
+	return out
+}
+
+// Replace the name of an attribute or the type of a block.
+func renamed(value hclwrite.Tokens, name string) hclwrite.Tokens {
+	out := append(hclwrite.Tokens{}, value...)
+	out[0] = &hclwrite.Token{Type: value[0].Type, Bytes: []byte(name)}
+	return out
+}
+
+// Append tokens to out, terminated by a newline.
+func appendLines(out hclwrite.Tokens, tokens hclwrite.Tokens) hclwrite.Tokens {
+	out = append(out, tokens...)
+	if len(out) > 0 && !endsLine(out[len(out)-1]) {
+		out = appendNewline(out)
+	}
+	return out
+}
+
+// Append comments to out, each on its own line.
+func appendComments(out hclwrite.Tokens, comments hclwrite.Tokens) hclwrite.Tokens {
+	for _, comment := range comments {
+		out = appendLines(out, hclwrite.Tokens{comment})
+	}
+	return out
+}
+
+func appendNewline(out hclwrite.Tokens) hclwrite.Tokens {
+	return append(out, &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")})
+}
+
+func endsLine(token *hclwrite.Token) bool {
+	return token.Type == hclsyntax.TokenNewline ||
+		(token.Type == hclsyntax.TokenComment && bytes.HasSuffix(token.Bytes, []byte("\n")))
+}
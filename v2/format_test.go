@@ -0,0 +1,203 @@
+package konghcl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	var cli struct {
+		Port    int
+		Name    string
+		Verbose bool
+		DB      struct {
+			DSN   string
+			Trace bool
+			Pool  map[string]int
+		} `embed:"" prefix:"db-"`
+		Server struct {
+			Host string
+		} `cmd:""`
+	}
+	parser, err := kong.New(&cli)
+	require.NoError(t, err)
+
+	source := `# Header comment.
+
+# The database.
+db {
+  trace = true
+}
+
+verbose = true # Noisy.
+unknown = "kept"
+
+/* Connection string. */
+db-dsn = "root@/database"
+
+// The port.
+port = 8080
+
+legacy-name = "app"
+
+locals {
+  base = 8000
+}
+
+server {
+  host = "localhost"
+}
+
+db {
+  pool {
+    size = 10
+  }
+}
+
+plugin "auth" {
+  enabled = true
+}
+`
+	formatted, err := Format(parser.Model, "config.hcl", []byte(source), DeprecatedKey("legacy-name", "name"))
+	require.NoError(t, err)
+	require.Equal(t, `# Header comment.
+
+locals {
+  base = 8000
+}
+
+name = "app"
+// The port.
+port    = 8080
+verbose = true # Noisy.
+unknown = "kept"
+
+/* Connection string. */
+# The database.
+db {
+  dsn = "root@/database"
+  pool {
+    size = 10
+  }
+  trace = true
+}
+
+server {
+  host = "localhost"
+}
+
+plugin "auth" {
+  enabled = true
+}
+`, string(formatted))
+
+	again, err := Format(parser.Model, "config.hcl", formatted)
+	require.NoError(t, err)
+	require.Equal(t, string(formatted), string(again))
+}
+
+func TestFormatConfig(t *testing.T) {
+	var cli struct {
+		Port         int
+		Name         string
+		FormatConfig FormatConfig
+	}
+	dir, err := ioutil.TempDir("", "kong-hcl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.hcl")
+	require.NoError(t, ioutil.WriteFile(path, []byte("port = 8080\nname = \"app\"\n"), 0600))
+	jsonPath := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(jsonPath, []byte(`{"port": 8080}`), 0600))
+	stdout := &strings.Builder{}
+	exited := false
+	parser, err := kong.New(&cli,
+		Configuration(Loader, path, jsonPath),
+		kong.Writers(stdout, ioutil.Discard),
+		kong.Exit(func(int) { exited = true }))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"--format-config"})
+	require.NoError(t, err)
+	require.True(t, exited)
+	require.Equal(t, path+"\n", stdout.String())
+	formatted, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "name = \"app\"\nport = 8080\n", string(formatted))
+	formatted, err = ioutil.ReadFile(jsonPath)
+	require.NoError(t, err)
+	require.Equal(t, `{"port": 8080}`, string(formatted))
+
+	_, err = Format(parser.Model, "config.hcl", []byte(`{"port": 8080}`))
+	require.EqualError(t, err, "config.hcl: JSON configuration can't be formatted")
+}
+
+func TestFormatReferences(t *testing.T) {
+	type config struct {
+		Backup string
+		DB     struct {
+			DSN   string
+			Trace bool
+		} `embed:"" prefix:"db-"`
+	}
+	var cli config
+	parser, err := kong.New(&cli)
+	require.NoError(t, err)
+	source := `db-trace = true
+db-dsn = "root@/database"
+backup = "${db-dsn}.bak"
+`
+	formatted, err := Format(parser.Model, "config.hcl", []byte(source))
+	require.NoError(t, err)
+	require.Equal(t, `backup = "${db-dsn}.bak"
+db-dsn = "root@/database"
+
+db {
+  trace = true
+}
+`, string(formatted))
+
+	// The formatted configuration resolves to the same values.
+	resolve := func(source []byte) config {
+		var cli config
+		resolver, err := Loader(bytes.NewReader(source))
+		require.NoError(t, err)
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse(nil)
+		require.NoError(t, err)
+		return cli
+	}
+	require.Equal(t, resolve([]byte(source)), resolve(formatted))
+	require.Equal(t, "root@/database.bak", resolve(formatted).Backup)
+
+	// A referenced attribute that would be replaced is not formatted.
+	_, err = Format(parser.Model, "config.hcl", []byte("old-dsn = \"a\"\ndb-dsn = \"b\"\nbackup = old-dsn\n"), DeprecatedKey("old-dsn", "db-dsn"))
+	require.EqualError(t, err, `config.hcl: can't format configuration, as it would remove "old-dsn", which other attributes refer to`)
+}
+
+func TestFormatConflicts(t *testing.T) {
+	var cli struct {
+		DB struct {
+			DSN   string
+			Trace bool
+		} `embed:"" prefix:"db-"`
+	}
+	parser, err := kong.New(&cli)
+	require.NoError(t, err)
+
+	// The same value flat and in a block is written once.
+	formatted, err := Format(parser.Model, "config.hcl", []byte("db-trace = true\ndb {\n  trace = true # Again.\n}\n"))
+	require.NoError(t, err)
+	require.Equal(t, "db {\n  trace = true\n}\n", string(formatted))
+
+	// Different values are not, as only one of them would be kept.
+	_, err = Format(parser.Model, "config.hcl", []byte("db-dsn = \"a\"\ndb {\n  dsn = \"b\"\n  trace = true\n}\n"))
+	require.EqualError(t, err, `config.hcl: can't format configuration, as "db-dsn" is set to different values flat and in a block`)
+}
@@ -0,0 +1,103 @@
+package konghcl
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/alecthomas/kong-hcl/core"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// DisableFileAccess prevents configuration from reading files with file() and templatefile().
+//
+// This should be used when loading configuration that is not trusted.
+func DisableFileAccess() Option {
+	return core.DisableFileAccess()
+}
+
+// Build the functions available to configuration.
+//
+// Relative paths are resolved against baseDir, the directory of the configuration file.
+func functions(baseDir string, fileAccess bool) map[string]function.Function {
+	file := fileFunc(baseDir, fileAccess)
+	return map[string]function.Function{
+		"file":         file,
+		"templatefile": templateFileFunc(baseDir, fileAccess, map[string]function.Function{"file": file}),
+	}
+}
+
+// file(path) returns the contents of a UTF-8 encoded file.
+func fileFunc(baseDir string, fileAccess bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "path", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			content, err := readFile(baseDir, fileAccess, args[0].AsString())
+			if err != nil {
+				return cty.UnknownVal(cty.String), err
+			}
+			return cty.StringVal(content), nil
+		},
+	})
+}
+
+// templatefile(path, vars) renders the template in a file, with the variables in the object vars.
+func templateFileFunc(baseDir string, fileAccess bool, funcs map[string]function.Function) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "path", Type: cty.String},
+			{Name: "vars", Type: cty.DynamicPseudoType},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path, vars := args[0].AsString(), args[1]
+			if ty := vars.Type(); !ty.IsObjectType() && !ty.IsMapType() {
+				return cty.UnknownVal(cty.String), errors.Errorf("template variables must be an object but got %s", ty.FriendlyName())
+			}
+			if !vars.IsWhollyKnown() || vars.IsNull() {
+				return cty.UnknownVal(cty.String), errors.New("template variables must be known")
+			}
+			content, err := readFile(baseDir, fileAccess, path)
+			if err != nil {
+				return cty.UnknownVal(cty.String), err
+			}
+			expr, diags := hclsyntax.ParseTemplate([]byte(content), path, hcl.Pos{Line: 1, Column: 1})
+			if diags.HasErrors() {
+				return cty.UnknownVal(cty.String), diags
+			}
+			ctx := &hcl.EvalContext{Variables: vars.AsValueMap(), Functions: funcs}
+			value, diags := expr.Value(ctx)
+			if diags.HasErrors() {
+				return cty.UnknownVal(cty.String), diags
+			}
+			value, err = convert.Convert(value, cty.String)
+			if err != nil {
+				return cty.UnknownVal(cty.String), errors.Wrap(err, "template result")
+			}
+			return value, nil
+		},
+	})
+}
+
+func readFile(baseDir string, fileAccess bool, path string) (string, error) {
+	if !fileAccess {
+		return "", errors.New("file access is disabled for this configuration")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	content, err := ioutil.ReadFile(path) // nolint: gosec
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if !utf8.Valid(content) {
+		return "", errors.Errorf("contents of %s are not valid UTF-8", path)
+	}
+	return string(content), nil
+}
@@ -2,6 +2,7 @@ module github.com/alecthomas/kong-hcl/v2
 
 require (
 	github.com/alecthomas/kong v0.2.17
+	github.com/alecthomas/kong-hcl/core v0.1.0
 	github.com/hashicorp/hcl/v2 v2.0.0
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.7.0
@@ -9,3 +10,6 @@ require (
 )
 
 go 1.13
+
+// Build against the core module in this repository; users of this module get the version required above.
+replace github.com/alecthomas/kong-hcl/core => ../core
@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
+	"math/big"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/alecthomas/kong"
+	"github.com/alecthomas/kong-hcl/core"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
 	"github.com/hashicorp/hcl/v2/hclparse"
@@ -19,29 +21,110 @@ import (
 )
 
 // Resolver resolves kong Flags from configuration in HCL.
-type Resolver struct {
-	config map[string]interface{}
+type Resolver = core.Resolver
+
+// An Option configures how a Resolver is loaded.
+type Option = core.Option
+
+// ProfileFlag enables named configuration profiles, selected by the value of the given flag.
+//
+// See core.ProfileFlag for details.
+func ProfileFlag(flag string) Option {
+	return core.ProfileFlag(flag)
+}
+
+// AllowKeys permits configuration keys that do not correspond to any flag, and all keys below them.
+//
+// See core.AllowKeys for details.
+func AllowKeys(keys ...string) Option {
+	return core.AllowKeys(keys...)
+}
+
+// ValidationMode controls how problems found by Resolver.Validate are reported.
+type ValidationMode = core.ValidationMode
+
+// Validation modes.
+const (
+	// ValidateStrict fails validation on unknown keys. Other problems are reported as warnings.
+	ValidateStrict = core.ValidateStrict
+	// ValidateWarn reports all problems as warnings.
+	ValidateWarn = core.ValidateWarn
+	// ValidateIgnore does not report any problems.
+	ValidateIgnore = core.ValidateIgnore
+)
+
+// A Warning about configuration that does not prevent it from being used.
+type Warning = core.Warning
+
+// Validation sets the ValidationMode. The default is ValidateStrict.
+func Validation(mode ValidationMode) Option {
+	return core.Validation(mode)
+}
+
+// WarningHandler sets the function that configuration warnings are delivered to.
+//
+// The default writes warnings to os.Stderr.
+func WarningHandler(handler func(Warning)) Option {
+	return core.WarningHandler(handler)
+}
+
+// WarningWriter returns a warning handler that writes each warning to w on its own line.
+func WarningWriter(w io.Writer) func(Warning) {
+	return core.WarningWriter(w)
+}
+
+// DeprecatedKey permits the configuration key "key" as a deprecated spelling of "replacement".
+//
+// See core.DeprecatedKey for details.
+func DeprecatedKey(key, replacement string) Option {
+	return core.DeprecatedKey(key, replacement)
+}
+
+// KeyStyle is the style in which multi-word configuration keys are written.
+type KeyStyle = core.KeyStyle
+
+// Key styles.
+const (
+	// KebabCase keys are separated with hyphens, eg. "max-conns", matching kong flag names.
+	KebabCase = core.KebabCase
+	// SnakeCase keys are separated with underscores, eg. "max_conns", as is idiomatic in HCL.
+	SnakeCase = core.SnakeCase
+)
+
+// NormaliseKeys accepts configuration keys separated with either hyphens or underscores.
+//
+// See core.NormaliseKeys for details.
+func NormaliseKeys(style KeyStyle) Option {
+	return core.NormaliseKeys(style)
 }
 
 var _ kong.ConfigurationLoader = Loader
 
+// A DecodeOption configures how DecodeValue decodes values.
+type DecodeOption = core.DecodeOption
+
+// GuessFiles restores the original behaviour of DecodeValue, where a value is read as a file if a
+// file of that name exists, and is otherwise parsed as HCL. It is only provided for compatibility.
+func GuessFiles() DecodeOption {
+	return core.GuessFiles()
+}
+
 // DecodeValue decodes Kong values into a Go structure.
-func DecodeValue(ctx *kong.DecodeContext, dest interface{}) error {
+//
+// String values of the form "@path" are read from the file at path, "-" is read from stdin, and
+// any other string is parsed as HCL.
+func DecodeValue(ctx *kong.DecodeContext, dest interface{}, options ...DecodeOption) error {
 	v := ctx.Scan.Pop().Value
 	var (
 		data []byte
 		err  error
 	)
-	filename := "config.hcl"
+	filename := ""
 	switch v := v.(type) {
 	case string:
-		// Value is a string; it can either be a filename or a HCL fragment.
-		filename = kong.ExpandPath(v)
-		data, err = ioutil.ReadFile(filename) // nolint: gosec
-		if os.IsNotExist(err) {
-			data = []byte(v)
-		} else if err != nil {
-			return errors.Wrapf(err, "invalid HCL in %q", filename)
+		filename, data, err = core.ReadSource(v, options...)
+		if err != nil {
+			return err
 		}
 	case []map[string]interface{}:
 		merged := map[string]interface{}{}
@@ -62,274 +145,280 @@ func DecodeValue(ctx *kong.DecodeContext, dest interface{}) error {
 		}
 	}
 
-	parser := hclparse.NewParser()
-	var (
-		ast  *hcl.File
-		diag hcl.Diagnostics
-	)
-	if bytes.HasPrefix(data, []byte("{")) {
-		ast, diag = parser.ParseJSON(data, filename)
-	} else {
-		ast, diag = parser.ParseHCL(data, filename)
-	}
+	ast, diag := parse(data, filename, bytes.HasPrefix(data, []byte("{")))
 	if diag.HasErrors() {
-		return errors.Errorf("invalid HCL %s: %s", data, diag[0].Summary)
+		return diagnostics(filename, data, diag)
 	}
 	diag = gohcl.DecodeBody(ast.Body, nil, dest)
 	if diag.HasErrors() {
-		return errors.Errorf("invalid HCL %s: %s", data, diag[0].Summary)
+		return diagnostics(filename, data, diag)
 	}
 	return nil
 }
 
 // Loader is a Kong configuration loader for HCL.
+//
+// Configuration may be in either HCL native syntax or HCL JSON syntax. JSON is
+// detected by a ".json" file extension or a leading "{".
 func Loader(r io.Reader) (kong.Resolver, error) {
-	filename := "config.hcl"
-	if named, ok := r.(interface{ Name() string }); ok {
-		filename = named.Name()
-	}
-	parser := hclparse.NewParser()
-	source, err := ioutil.ReadAll(r)
+	return NewLoader()(r)
+}
+
+// NewLoader creates a Kong configuration loader for HCL with the given options.
+func NewLoader(options ...Option) kong.ConfigurationLoader {
+	return core.NewLoader(parseConfig, options...)
+}
+
+// NewResolver creates a Resolver from in-memory configuration.
+//
+// Keys and blocks are interpreted exactly as if they had been loaded from HCL, with nested maps
+// as blocks. Values may be nil, bools, strings, numbers, or slices and string-keyed maps of
+// those. Values of any other type are an error.
+func NewResolver(config map[string]interface{}, options ...Option) (*Resolver, error) {
+	tree, err := core.TreeFromMap(config)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
-	ast, diag := parser.ParseHCL(source, filename)
-	if diag.HasErrors() {
-		return nil, errors.Wrap(diag, filename)
+	return core.New(tree, options...)
+}
+
+// NewResolverFromValue creates a Resolver from a cty object or map value.
+//
+// Nested objects and maps are interpreted as blocks.
+func NewResolverFromValue(value cty.Value, options ...Option) (*Resolver, error) {
+	if !value.IsKnown() || value.IsNull() {
+		return nil, errors.New("configuration value must be a known, non-null object or map")
+	}
+	if ty := value.Type(); !ty.IsObjectType() && !ty.IsMapType() {
+		return nil, errors.Errorf("configuration value must be an object or map but got %s", ty.FriendlyName())
 	}
-	config := map[string]interface{}{}
-	err = flattenHCL(nil, ast.Body.(*hclsyntax.Body), config)
+	config, err := decodeCTYValue(value)
 	if err != nil {
 		return nil, err
 	}
-	return &Resolver{config: config}, nil
+	return core.New(core.NewTree(config.(map[string]interface{})), options...)
 }
 
-func flattenHCL(key []string, node hclsyntax.Node, dest map[string]interface{}) (err error) {
-	defer func() {
-		if err != nil && len(key) > 0 {
-			err = errors.Wrap(err, key[len(key)-1])
+// Returns true if the configuration in source is JSON, either because of the extension of
+// filename or because it starts with an object.
+func isJSON(filename string, source []byte) bool {
+	return strings.HasSuffix(filename, ".json") || bytes.HasPrefix(bytes.TrimSpace(source), []byte("{"))
+}
+
+// Parse HCL native or JSON syntax into a configuration tree.
+//
+// Paths passed to file functions are relative to the directory of filename.
+func parseConfig(filename string, source []byte, fileAccess bool) (*core.Tree, error) {
+	hclFilename := filename
+	if hclFilename == "" {
+		hclFilename = "config.hcl"
+	}
+	ast, diag := parse(source, hclFilename, isJSON(filename, source))
+	if diag.HasErrors() {
+		return nil, diagnostics(filename, source, diag)
+	}
+	tree := core.NewTree(map[string]interface{}{})
+	switch body := ast.Body.(type) {
+	case *hclsyntax.Body:
+		var ctx *hcl.EvalContext
+		baseDir := "."
+		if filename != "" {
+			baseDir = filepath.Dir(filename)
 		}
-	}()
-	switch node := node.(type) {
-	case hclsyntax.Attributes:
-		for attr, value := range node {
-			if err := flattenHCL(append(key, attr), value, dest); err != nil {
-				return err
-			}
+		ctx, diag = evalContext(body, functions(baseDir, fileAccess))
+		if diag.HasErrors() {
+			return nil, diagnostics(filename, source, diag)
 		}
-	case *hclsyntax.Attribute:
-		value, err := decodeHCLExpr(node.Expr)
-		if err != nil {
-			return err
+		diag = flattenHCL(tree, filename, nil, body, tree.Root, ctx)
+	default:
+		diag = flattenJSON(tree, filename, body)
+	}
+	if diag.HasErrors() {
+		return nil, diagnostics(filename, source, diag)
+	}
+	return tree, nil
+}
+
+// Parse HCL or JSON source.
+//
+// Panics in the underlying parser are returned as diagnostics, so that malformed input can
+// never crash the application.
+func parse(source []byte, filename string, isJSON bool) (ast *hcl.File, diag hcl.Diagnostics) {
+	defer func() {
+		if r := recover(); r != nil {
+			ast = nil
+			diag = hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid configuration",
+				Detail:   fmt.Sprintf("Failed to parse %s: %v.", filename, r),
+			}}
 		}
-		dest[strings.Join(key, "-")] = value
-	case hclsyntax.Blocks:
-		for _, block := range node {
-			if err := flattenHCL(key, block, dest); err != nil {
-				return err
-			}
+	}()
+	parser := hclparse.NewParser()
+	if isJSON {
+		return parser.ParseJSON(source, filename)
+	}
+	return parser.ParseHCL(source, filename)
+}
+
+// Convert a HCL body into configuration values at "path" in the tree.
+//
+// Blocks become lists of maps, with each label nested as a further block.
+func flattenHCL(tree *core.Tree, filename string, path []string, body *hclsyntax.Body, dest map[string]interface{}, ctx *hcl.EvalContext) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	// Attributes are visited in source order so that diagnostics are too.
+	attrs := make([]*hclsyntax.Attribute, 0, len(body.Attributes))
+	for _, attr := range body.Attributes {
+		attrs = append(attrs, attr)
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].NameRange.Start.Byte < attrs[j].NameRange.Start.Byte
+	})
+	for _, attr := range attrs {
+		name := attr.Name
+		value, diag := decodeHCLExpr(attr.Expr, ctx)
+		diags = append(diags, diag...)
+		dest[name] = value
+		tree.SetPosition(appendPath(path, name), position(filename, attr.NameRange))
+	}
+	for _, block := range body.Blocks {
+		if path == nil && block.Type == localsBlock {
+			continue
 		}
-	case *hclsyntax.Block:
-		sub := map[string]interface{}{}
-		key = append(key, node.Type)
-		for _, label := range node.Labels {
+		blockPath := appendPath(path, block.Type)
+		tree.SetPosition(blockPath, position(filename, block.TypeRange))
+		root := map[string]interface{}{}
+		sub := root
+		for i, label := range block.Labels {
+			blockPath = appendPath(blockPath, label)
+			tree.SetPosition(blockPath, position(filename, block.LabelRanges[i]))
 			next := map[string]interface{}{}
 			sub[label] = []map[string]interface{}{next}
 			sub = next
 		}
-		if err := flattenHCL(nil, node.Body, sub); err != nil {
-			return err
-		}
-		dkey := strings.Join(key, "-")
-		switch value := dest[dkey].(type) {
+		diags = append(diags, flattenHCL(tree, filename, blockPath, block.Body, sub, ctx)...)
+		switch value := dest[block.Type].(type) {
 		case nil:
-			dest[dkey] = []map[string]interface{}{sub}
+			dest[block.Type] = []map[string]interface{}{root}
 		case []map[string]interface{}:
-			value = append(value, sub)
-			dest[dkey] = value
-		}
-	case *hclsyntax.Body:
-		if err := flattenHCL(key, node.Attributes, dest); err != nil {
-			return err
+			dest[block.Type] = append(value, root)
 		}
-		if err := flattenHCL(key, node.Blocks, dest); err != nil {
-			return err
-		}
-	default:
-		panic(fmt.Sprintf("%T", node))
 	}
-	return nil
+	return diags
 }
 
-func decodeHCLExpr(expr hclsyntax.Expression) (interface{}, error) {
-	value, diag := expr.Value(nil)
-	if diag.HasErrors() {
-		return nil, errors.WithStack(diag)
+// Convert a HCL JSON body into configuration values.
+//
+// As JSON does not distinguish between blocks and objects, objects are
+// converted to maps, which are looked up in the same way as blocks.
+func flattenJSON(tree *core.Tree, filename string, body hcl.Body) hcl.Diagnostics {
+	attrs, diags := body.JustAttributes()
+	if diags.HasErrors() {
+		return diags
 	}
-	return decodeCTYValue(value), nil
-}
-
-func decodeCTYValue(value cty.Value) interface{} {
-	switch value.Type() {
-	case cty.String:
-		return value.AsString()
-	case cty.Bool:
-		return value.True()
-	case cty.Number:
-		f, _ := value.AsBigFloat().Float64()
-		return f
-	default:
-		if value.Type().IsListType() || value.Type().IsTupleType() {
-			out := []interface{}{}
-			value.ForEachElement(func(key cty.Value, val cty.Value) (stop bool) {
-				out = append(out, decodeCTYValue(val))
-				return false
-			})
-			return out
-		} else if value.Type().IsMapType() || value.Type().IsObjectType() {
-			out := map[string]interface{}{}
-			value.ForEachElement(func(key cty.Value, val cty.Value) (stop bool) {
-				out[key.AsString()] = decodeCTYValue(val)
-				return false
-			})
-			return out
-		}
+	for name, attr := range attrs {
+		value, diag := decodeHCLExpr(attr.Expr, nil)
+		diags = append(diags, diag...)
+		tree.Root[name] = value
+		tree.SetPosition([]string{name}, position(filename, attr.NameRange))
 	}
-	panic(value.Type().GoString())
+	return diags
 }
 
-func (r *Resolver) Validate(app *kong.Application) error { // nolint: golint
-	// Find all valid configuration keys from the Application.
-	valid := map[string]bool{}
-	rawPrefixes := []string{}
-	path := []string{}
-	_ = kong.Visit(app, func(node kong.Visitable, next kong.Next) error {
-		switch node := node.(type) {
-		case *kong.Node:
-			path = append(path, node.Name)
-			_ = next(nil)
-			path = path[:len(path)-1]
-			return nil
-
-		case *kong.Flag:
-			flagPath := append([]string{}, path...)
-			if node.Group != nil {
-				flagPath = append(flagPath, node.Group.Key)
-			}
-			key := strings.Join(append(flagPath, node.Name), "-")
-			if _, ok := node.Target.Interface().(kong.MapperValue); ok {
-				rawPrefixes = append(rawPrefixes, key)
-			} else {
-				valid[key] = true
-			}
-
-		default:
-			return next(nil)
-		}
-		return nil
-	})
-	// Then check all configuration keys against the Application keys.
-next:
-	for key := range flattenConfig(valid, r.config) {
-		if !valid[key] {
-			for _, prefix := range rawPrefixes {
-				if strings.HasPrefix(key, prefix) {
-					continue next
-				}
-			}
-			return errors.Errorf("unknown configuration key %q", key)
-		}
-	}
-	return nil
+func appendPath(path []string, key string) []string {
+	return append(append([]string{}, path...), key)
 }
 
-func (r *Resolver) Resolve(context *kong.Context, parent *kong.Path, flag *kong.Flag) (interface{}, error) { // nolint: golint
-	path := r.pathForFlag(parent, flag)
-	return find(r.config, path)
+func position(filename string, rng hcl.Range) core.Position {
+	return core.Position{Filename: filename, Line: rng.Start.Line, Column: rng.Start.Column}
 }
 
-// Build a string path up to this flag.
-func (r *Resolver) pathForFlag(parent *kong.Path, flag *kong.Flag) []string {
-	path := []string{}
-	for n := parent.Node(); n != nil && n.Type != kong.ApplicationNode; n = n.Parent {
-		path = append([]string{n.Name}, path...)
+func decodeHCLExpr(expr hcl.Expression, ctx *hcl.EvalContext) (interface{}, hcl.Diagnostics) {
+	value, diag := expr.Value(ctx)
+	if diag.HasErrors() {
+		return nil, diag
 	}
-	if flag.Group != nil {
-		path = append([]string{flag.Group.Key}, path...)
+	out, err := decodeCTYValue(value)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported value",
+			Detail:   err.Error(),
+			Subject:  expr.Range().Ptr(),
+		}}
 	}
-	path = append(path, flag.Name)
-	return path
+	return out, nil
 }
 
-// Find the value that path maps to.
-func find(config map[string]interface{}, path []string) (interface{}, error) {
-	if len(path) == 0 {
-		return config, nil
-	}
-
-	key := strings.Join(path, "-")
-	parts := strings.SplitN(key, "-", -1)
-	for i := len(parts); i > 0; i-- {
-		prefix := strings.Join(parts[:i], "-")
-		if sub := config[prefix]; sub != nil {
-			if sub, ok := sub.([]map[string]interface{}); ok {
-				if len(sub) > 1 {
-					return sub, nil
-				}
-				return find(sub[0], parts[i:])
-			}
-			return sub, nil
+// Convert HCL diagnostics for the source of filename into an error.
+func diagnostics(filename string, source []byte, diags hcl.Diagnostics) error {
+	out := core.NewDiagnostics(filename, source)
+	for _, diag := range diags {
+		converted := core.Diagnostic{Summary: diag.Summary, Detail: diag.Detail}
+		if diag.Severity == hcl.DiagWarning {
+			converted.Severity = core.SeverityWarning
 		}
-	}
-	return nil, nil
-}
-
-func flattenConfig(schema map[string]bool, config map[string]interface{}) map[string]bool {
-	out := map[string]bool{}
-next:
-	for _, path := range flattenNode(config) {
-		for i := len(path) - 1; i >= 0; i-- {
-			candidate := strings.Join(path[:i], "-")
-			if schema[candidate] {
-				out[candidate] = true
-				continue next
-			}
+		if diag.Subject != nil {
+			converted.Pos = position(filename, *diag.Subject)
+			converted.End = core.Position{Filename: filename, Line: diag.Subject.End.Line, Column: diag.Subject.End.Column}
 		}
-		out[strings.Join(path, "-")] = true
+		out.Diagnostics = append(out.Diagnostics, converted)
 	}
 	return out
 }
 
-func flattenNode(config interface{}) [][]string {
-	out := [][]string{}
-	switch config := config.(type) {
-	case []map[string]interface{}:
-		for _, group := range config {
-			out = append(out, flattenNode(group)...)
+// Decode a cty.Value into plain Go values.
+//
+// Null values decode to nil, which is treated as an unset key.
+func decodeCTYValue(value cty.Value) (interface{}, error) {
+	if !value.IsKnown() {
+		return nil, errors.New("value is not known")
+	}
+	if value.IsNull() {
+		return nil, nil
+	}
+	ty := value.Type()
+	switch {
+	case ty == cty.String:
+		return value.AsString(), nil
+	case ty == cty.Bool:
+		return value.True(), nil
+	case ty == cty.Number:
+		// Preserve integers exactly, as float64 can only represent integers up to 2^53.
+		n := value.AsBigFloat()
+		if n.IsInt() {
+			if i, accuracy := n.Int64(); accuracy == big.Exact {
+				return i, nil
+			}
+			if u, accuracy := n.Uint64(); accuracy == big.Exact {
+				return u, nil
+			}
 		}
-	case map[string]interface{}:
-		for key, value := range config {
-			children := flattenNode(value)
-			if len(children) == 0 {
-				out = append(out, []string{key})
-			} else {
-				for _, childValue := range children {
-					out = append(out, append([]string{key}, childValue...))
-				}
+		f, _ := n.Float64()
+		return f, nil
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType():
+		out := []interface{}{}
+		for it := value.ElementIterator(); it.Next(); {
+			_, el := it.Element()
+			decoded, err := decodeCTYValue(el)
+			if err != nil {
+				return nil, err
 			}
+			out = append(out, decoded)
 		}
-
-	case []interface{}:
-		for _, el := range config {
-			out = flattenNode(el)
+		return out, nil
+	case ty.IsMapType() || ty.IsObjectType():
+		out := map[string]interface{}{}
+		for it := value.ElementIterator(); it.Next(); {
+			key, el := it.Element()
+			decoded, err := decodeCTYValue(el)
+			if err != nil {
+				return nil, errors.Wrap(err, key.AsString())
+			}
+			out[key.AsString()] = decoded
 		}
-
-	case bool, float64, int, string:
-		return nil
-
+		return out, nil
 	default:
-		panic(fmt.Sprintf("unsupported type %T", config))
+		return nil, errors.Errorf("unsupported value of type %s", ty.FriendlyName())
 	}
-	return out
 }
@@ -4,12 +4,16 @@ package konghcl
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/alecthomas/kong"
+	"github.com/alecthomas/kong-hcl/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
 )
 
 const testConfig = `
@@ -114,7 +118,7 @@ func TestHCL(t *testing.T) {
 		var cli CLI
 		parser, err := kong.New(&cli)
 		require.NoError(t, err)
-		_, err = parser.Parse([]string{"--mapped", w.Name()})
+		_, err = parser.Parse([]string{"--mapped", "@" + w.Name()})
 		require.NoError(t, err)
 		require.Equal(t, mapperValue{Left: "LEFT", Right: "RIGHT"}, cli.Mapped)
 	})
@@ -137,3 +141,707 @@ func TestHCLValidation(t *testing.T) {
 	_, err = parser.Parse([]string{"command"})
 	require.EqualError(t, err, "unknown configuration key \"invalid-flag\"")
 }
+
+func TestHCLInheritedFlags(t *testing.T) {
+	type serve struct {
+		Port int
+	}
+	type cli struct {
+		LogLevel string
+		Serve    serve    `cmd:""`
+		Check    struct{} `cmd:""`
+	}
+	resolver, err := Loader(strings.NewReader(`
+		log-level = "info"
+		serve {
+			log-level = "debug"
+			port = 8080
+		}
+	`))
+	require.NoError(t, err)
+
+	t.Run("Override", func(t *testing.T) {
+		var cli cli
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse([]string{"serve"})
+		require.NoError(t, err)
+		assert.Equal(t, "debug", cli.LogLevel)
+		assert.Equal(t, 8080, cli.Serve.Port)
+	})
+
+	t.Run("Parent", func(t *testing.T) {
+		var cli cli
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse([]string{"check"})
+		require.NoError(t, err)
+		assert.Equal(t, "info", cli.LogLevel)
+	})
+
+	t.Run("CommandLine", func(t *testing.T) {
+		var cli cli
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse([]string{"serve", "--log-level=warn"})
+		require.NoError(t, err)
+		assert.Equal(t, "warn", cli.LogLevel)
+	})
+}
+
+func TestHCLGroupedCommandFlags(t *testing.T) {
+	type serve struct {
+		Timeout int `group:"limits"`
+	}
+	var cli struct {
+		Serve serve `cmd:""`
+	}
+	parse := func(config string) error {
+		resolver, err := Loader(strings.NewReader(config))
+		require.NoError(t, err)
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse([]string{"serve"})
+		return err
+	}
+
+	// The group's block is inside the command's block.
+	require.NoError(t, parse(`
+		serve {
+			limits {
+				timeout = 5
+			}
+		}
+	`))
+	assert.Equal(t, 5, cli.Serve.Timeout)
+	require.NoError(t, parse(`serve-limits-timeout = 10`))
+	assert.Equal(t, 10, cli.Serve.Timeout)
+	require.NoError(t, parse(`serve { timeout = 15 }`))
+	assert.Equal(t, 15, cli.Serve.Timeout)
+
+	err := parse(`
+		limits {
+			serve {
+				timeout = 20
+			}
+		}
+	`)
+	require.EqualError(t, err, `unknown configuration key "limits-serve-timeout"`)
+}
+
+func TestHCLProfiles(t *testing.T) {
+	type cli struct {
+		Profile string `env:"KONGHCL_TEST_PROFILE"`
+		Debug   bool
+		DB      struct {
+			DSN string
+		} `embed:"" prefix:"db-"`
+	}
+	const config = `
+		db {
+			dsn = "root@/database"
+		}
+
+		profile "staging" {
+			debug = true
+			db {
+				dsn = "staging@/database"
+			}
+		}
+	`
+	parse := func(t *testing.T, config string, args ...string) (*cli, error) {
+		t.Helper()
+		var cli cli
+		resolver, err := NewLoader(ProfileFlag("profile"))(strings.NewReader(config))
+		require.NoError(t, err)
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse(args)
+		return &cli, err
+	}
+
+	t.Run("Base", func(t *testing.T) {
+		cli, err := parse(t, config)
+		require.NoError(t, err)
+		assert.Equal(t, "root@/database", cli.DB.DSN)
+		assert.False(t, cli.Debug)
+	})
+
+	t.Run("Flag", func(t *testing.T) {
+		cli, err := parse(t, config, "--profile=staging")
+		require.NoError(t, err)
+		assert.Equal(t, "staging@/database", cli.DB.DSN)
+		assert.True(t, cli.Debug)
+	})
+
+	t.Run("Env", func(t *testing.T) {
+		os.Setenv("KONGHCL_TEST_PROFILE", "staging")
+		defer os.Unsetenv("KONGHCL_TEST_PROFILE")
+		cli, err := parse(t, config)
+		require.NoError(t, err)
+		assert.Equal(t, "staging@/database", cli.DB.DSN)
+	})
+
+	t.Run("UnknownProfile", func(t *testing.T) {
+		_, err := parse(t, config, "--profile=production")
+		require.EqualError(t, err, `unknown configuration profile "production"`)
+	})
+
+	t.Run("ValidatesInactiveProfiles", func(t *testing.T) {
+		_, err := parse(t, `
+			profile "production" {
+				invalid-flag = true
+			}
+		`)
+		require.EqualError(t, err, `profile "production": unknown configuration key "invalid-flag"`)
+	})
+}
+
+func TestHCLNull(t *testing.T) {
+	var cli struct {
+		Name  string `default:"default"`
+		Ports []int
+	}
+	resolver, err := Loader(strings.NewReader(`
+		name = null
+		ports = [80, 443]
+	`))
+	require.NoError(t, err)
+	parser, err := kong.New(&cli, kong.Resolvers(resolver))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "default", cli.Name)
+	assert.Equal(t, []int{80, 443}, cli.Ports)
+}
+
+func TestDecodeCTYValue(t *testing.T) {
+	value, err := decodeCTYValue(cty.SetVal([]cty.Value{cty.StringVal("a")}))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"a"}, value)
+
+	value, err = decodeCTYValue(cty.NullVal(cty.DynamicPseudoType))
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	value, err = decodeCTYValue(cty.ObjectVal(map[string]cty.Value{"key": cty.NullVal(cty.String)}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"key": nil}, value)
+
+	_, err = decodeCTYValue(cty.UnknownVal(cty.String))
+	require.EqualError(t, err, "value is not known")
+
+	_, err = decodeCTYValue(cty.ListVal([]cty.Value{cty.UnknownVal(cty.Number)}))
+	require.Error(t, err)
+
+	_, err = decodeCTYValue(cty.CapsuleVal(cty.Capsule("thing", reflect.TypeOf(0)), new(int)))
+	require.EqualError(t, err, "unsupported value of type thing")
+}
+
+func TestHCLNumbers(t *testing.T) {
+	type cli struct {
+		ID       int64
+		Quota    uint64
+		Count    int
+		Ratio    float64
+		Weights  []float64
+		Replicas []int
+	}
+	parse := func(t *testing.T, config string) (*cli, error) {
+		t.Helper()
+		var cli cli
+		resolver, err := Loader(strings.NewReader(config))
+		require.NoError(t, err)
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse(nil)
+		return &cli, err
+	}
+
+	t.Run("Exact", func(t *testing.T) {
+		cli, err := parse(t, `
+			id = 9007199254740993
+			quota = 18446744073709551615
+			count = 1000000
+			ratio = 2
+			weights = [1, 0.5]
+			replicas = [3, 5]
+		`)
+		require.NoError(t, err)
+		assert.Equal(t, int64(9007199254740993), cli.ID)
+		assert.Equal(t, uint64(18446744073709551615), cli.Quota)
+		assert.Equal(t, 1000000, cli.Count)
+		assert.Equal(t, 2.0, cli.Ratio)
+		assert.Equal(t, []float64{1, 0.5}, cli.Weights)
+		assert.Equal(t, []int{3, 5}, cli.Replicas)
+	})
+
+	t.Run("FractionalInteger", func(t *testing.T) {
+		_, err := parse(t, `count = 10.5`)
+		require.EqualError(t, err, "--count: expected an integer but got 10.5")
+		_, err = parse(t, `replicas = [1, 2.5]`)
+		require.EqualError(t, err, "--replicas: expected an integer but got 2.5")
+		_, err = parse(t, `quota = -1.5`)
+		require.EqualError(t, err, "--quota: expected an unsigned integer but got -1.5")
+	})
+}
+
+func TestHCLValidationPosition(t *testing.T) {
+	w, err := ioutil.TempFile("", "kong-hcl-*.hcl")
+	require.NoError(t, err)
+	defer os.Remove(w.Name())
+	_, err = w.WriteString("flag = \"value\"\n\ndb {\n  dsn = \"root@/database\"\n}\n")
+	require.NoError(t, err)
+	_ = w.Close()
+
+	var cli struct {
+		Flag string
+	}
+	parser, err := kong.New(&cli, kong.Configuration(Loader, w.Name()))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.EqualError(t, err, w.Name()+`:4:3: unknown configuration key "db-dsn"`)
+}
+
+func TestHCLJSON(t *testing.T) {
+	var cli struct {
+		Flag string
+		DB   struct {
+			DSN   string
+			Trace bool
+		} `embed:"" prefix:"db-"`
+		MapFlag map[string]string
+	}
+	resolver, err := Loader(strings.NewReader(`{
+		"flag": "value",
+		"db": {"dsn": "root@/database", "trace": true},
+		"map-flag": {"key": "value"}
+	}`))
+	require.NoError(t, err)
+	parser, err := kong.New(&cli, kong.Resolvers(resolver))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "value", cli.Flag)
+	assert.Equal(t, "root@/database", cli.DB.DSN)
+	assert.True(t, cli.DB.Trace)
+	assert.Equal(t, map[string]string{"key": "value"}, cli.MapFlag)
+}
+
+func TestNewResolver(t *testing.T) {
+	var cli struct {
+		Flag  string
+		Port  int
+		Ratio float64
+		Tags  []string
+		DB    struct {
+			DSN string
+		} `embed:"" prefix:"db-"`
+	}
+	resolver, err := NewResolver(map[string]interface{}{
+		"flag":  "value",
+		"port":  int32(8080),
+		"ratio": float32(0.5),
+		"tags":  []string{"a", "b"},
+		"db":    map[string]string{"dsn": "root@/database"},
+	})
+	require.NoError(t, err)
+	parser, err := kong.New(&cli, kong.Resolvers(resolver))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "value", cli.Flag)
+	assert.Equal(t, 8080, cli.Port)
+	assert.Equal(t, 0.5, cli.Ratio)
+	assert.Equal(t, []string{"a", "b"}, cli.Tags)
+	assert.Equal(t, "root@/database", cli.DB.DSN)
+
+	_, err = NewResolver(map[string]interface{}{"db": map[string]interface{}{"dsn": struct{}{}}})
+	require.EqualError(t, err, "db: dsn: unsupported value type struct {}")
+
+	resolver, err = NewResolver(map[string]interface{}{"invalid-flag": true})
+	require.NoError(t, err)
+	parser, err = kong.New(&cli, kong.Resolvers(resolver))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.EqualError(t, err, `unknown configuration key "invalid-flag"`)
+}
+
+func TestNewResolverFromValue(t *testing.T) {
+	var cli struct {
+		Flag string
+		Port int
+		DB   struct {
+			DSN string
+		} `embed:"" prefix:"db-"`
+	}
+	resolver, err := NewResolverFromValue(cty.ObjectVal(map[string]cty.Value{
+		"flag": cty.StringVal("value"),
+		"port": cty.NumberIntVal(8080),
+		"db":   cty.ObjectVal(map[string]cty.Value{"dsn": cty.StringVal("root@/database")}),
+	}))
+	require.NoError(t, err)
+	parser, err := kong.New(&cli, kong.Resolvers(resolver))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "value", cli.Flag)
+	assert.Equal(t, 8080, cli.Port)
+	assert.Equal(t, "root@/database", cli.DB.DSN)
+
+	_, err = NewResolverFromValue(cty.StringVal("value"))
+	require.EqualError(t, err, "configuration value must be an object or map but got string")
+
+	_, err = NewResolverFromValue(cty.ObjectVal(map[string]cty.Value{"flag": cty.UnknownVal(cty.String)}))
+	require.EqualError(t, err, "flag: value is not known")
+}
+
+func TestHCLSnakeCase(t *testing.T) {
+	type cli struct {
+		Flag string
+		Env  map[string]string
+		DB   struct {
+			DSN      string
+			MaxConns int
+			MaxIdle  int
+		} `embed:"" prefix:"db-"`
+	}
+	parse := func(t *testing.T, config string) (*cli, error) {
+		t.Helper()
+		resolver, err := NewLoader(NormaliseKeys(SnakeCase))(strings.NewReader(config))
+		if err != nil {
+			return nil, err
+		}
+		var cli cli
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse(nil)
+		return &cli, err
+	}
+
+	values, err := parse(t, `
+		flag = "value"
+		env = {
+			MY_VAR = "x"
+		}
+		db_dsn = "root@/database"
+		db {
+			max_conns = 5
+			max-idle = 2
+		}
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "value", values.Flag)
+	assert.Equal(t, map[string]string{"MY_VAR": "x"}, values.Env)
+	assert.Equal(t, "root@/database", values.DB.DSN)
+	assert.Equal(t, 5, values.DB.MaxConns)
+	assert.Equal(t, 2, values.DB.MaxIdle)
+
+	_, err = parse(t, `
+		db {
+			max_conn = 5
+		}
+	`)
+	require.EqualError(t, err, `unknown configuration key "db_max_conn"`)
+
+	_, err = parse(t, `
+		db_dsn = "root@/database"
+		db-dsn = "root@/database"
+	`)
+	require.EqualError(t, err, `--db-dsn: configuration keys "db-dsn" and "db_dsn" conflict`)
+}
+
+func TestHCLLabeledBlocks(t *testing.T) {
+	type server struct {
+		Host string
+		Port int
+	}
+	var cli struct {
+		Main   server `embed:"" prefix:"server-main-"`
+		Backup server `embed:"" prefix:"server-backup-"`
+		Worker struct {
+			Threads int
+		} `embed:"" prefix:"pool-worker-queue-"`
+	}
+	resolver, err := Loader(strings.NewReader(`
+		server "main" {
+			host = "main.example.com"
+			port = 80
+		}
+		server "backup" {
+			port = 8080
+		}
+		pool "worker" "queue" {
+			threads = 4
+		}
+	`))
+	require.NoError(t, err)
+	parser, err := kong.New(&cli, kong.Resolvers(resolver))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "main.example.com", cli.Main.Host)
+	assert.Equal(t, 80, cli.Main.Port)
+	assert.Equal(t, 8080, cli.Backup.Port)
+	assert.Equal(t, 4, cli.Worker.Threads)
+
+	resolver, err = Loader(strings.NewReader(`
+		server "spare" {
+			port = 80
+		}
+	`))
+	require.NoError(t, err)
+	parser, err = kong.New(&cli, kong.Resolvers(resolver))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.EqualError(t, err, `unknown configuration key "server-spare-port"`)
+}
+
+func TestHCLDiagnostics(t *testing.T) {
+	_, err := Loader(strings.NewReader("flag = upper(\"x\")\nother = foo + 1\n"))
+	require.EqualError(t, err, `Error: Call to unknown function
+
+  on line 1:
+     1: flag = upper("x")
+               ^^^^^
+
+There is no function named "upper".
+
+Error: Unknown variable
+
+  on line 2:
+     2: other = foo + 1
+                ^^^
+
+There is no variable named "foo".`)
+	diags, ok := err.(*core.Diagnostics)
+	require.True(t, ok)
+	assert.Len(t, diags.Diagnostics, 2)
+}
+
+func TestHCLLocals(t *testing.T) {
+	type cli struct {
+		DataDir string
+		LogDir  string
+		Hosts   []string
+		DB      struct {
+			DSN string
+		} `embed:"" prefix:"db-"`
+	}
+	parse := func(t *testing.T, config string) (*cli, error) {
+		t.Helper()
+		resolver, err := Loader(strings.NewReader(config))
+		if err != nil {
+			return nil, err
+		}
+		var cli cli
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse(nil)
+		return &cli, err
+	}
+
+	values, err := parse(t, `
+		locals {
+			base = "/srv/${local.name}"
+			name = "app"
+		}
+		log-dir = "${data-dir}/logs"
+		data-dir = "${local.base}/data"
+		hosts = ["${local.name}.example.com"]
+		db {
+			dsn = "${local.name}@/database"
+		}
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/app/data", values.DataDir)
+	assert.Equal(t, "/srv/app/data/logs", values.LogDir)
+	assert.Equal(t, []string{"app.example.com"}, values.Hosts)
+	assert.Equal(t, "app@/database", values.DB.DSN)
+
+	_, err = parse(t, `
+		locals {
+			a = local.b
+			b = "${local.a}"
+		}
+	`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Circular reference")
+	assert.Contains(t, err.Error(), "local.a refers to itself: local.a -> local.b -> local.a.")
+	assert.Len(t, err.(*core.Diagnostics).Diagnostics, 1)
+
+	_, err = parse(t, `data-dir = local.missing`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Unsupported attribute")
+}
+
+func TestHCLFileFunctions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kong-hcl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "certs"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "certs", "server.pem"), []byte("-----BEGIN CERTIFICATE-----\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "banner.tmpl"), []byte("Welcome to ${name}, ${upper}!"), 0600))
+	config := filepath.Join(dir, "config.hcl")
+	require.NoError(t, ioutil.WriteFile(config, []byte(`
+		tls-cert = file("certs/server.pem")
+		banner = templatefile("banner.tmpl", { name = "app", upper = "APP" })
+	`), 0600))
+
+	var cli struct {
+		TLSCert string
+		Banner  string
+	}
+	parser, err := kong.New(&cli, kong.Configuration(Loader, config))
+	require.NoError(t, err)
+	_, err = parser.Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "-----BEGIN CERTIFICATE-----\n", cli.TLSCert)
+	assert.Equal(t, "Welcome to app, APP!", cli.Banner)
+
+	_, err = kong.New(&cli, kong.Configuration(NewLoader(DisableFileAccess()), config))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "file access is disabled for this configuration")
+}
+
+func TestDecodeValueSources(t *testing.T) {
+	decode := func(t *testing.T, value string, options ...DecodeOption) (*mapperValue, error) {
+		t.Helper()
+		dest := &mapperValue{}
+		scan := kong.Scan().PushTyped(value, kong.FlagValueToken)
+		return dest, DecodeValue(&kong.DecodeContext{Scan: scan}, dest, options...)
+	}
+	w, err := ioutil.TempFile("", "kong-hcl-*.hcl")
+	require.NoError(t, err)
+	defer os.Remove(w.Name())
+	_, err = w.WriteString(`left = "file"`)
+	require.NoError(t, err)
+	_ = w.Close()
+
+	dest, err := decode(t, `left = "literal"`)
+	require.NoError(t, err)
+	assert.Equal(t, "literal", dest.Left)
+
+	dest, err = decode(t, "@"+w.Name())
+	require.NoError(t, err)
+	assert.Equal(t, "file", dest.Left)
+
+	_, err = decode(t, "@"+w.Name()+".missing")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no such file or directory")
+
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	os.Stdin, err = os.Open(w.Name())
+	require.NoError(t, err)
+	dest, err = decode(t, "-")
+	require.NoError(t, err)
+	assert.Equal(t, "file", dest.Left)
+
+	// Without "@", a filename is HCL.
+	_, err = decode(t, w.Name())
+	require.Error(t, err)
+
+	dest, err = decode(t, w.Name(), GuessFiles())
+	require.NoError(t, err)
+	assert.Equal(t, "file", dest.Left)
+	dest, err = decode(t, `left = "literal"`, GuessFiles())
+	require.NoError(t, err)
+	assert.Equal(t, "literal", dest.Left)
+}
+
+func TestValidateConfig(t *testing.T) {
+	var cli struct {
+		Port           int
+		Level          string `enum:"debug,info" default:"info"`
+		OldFlag        string `deprecated:"use --level"`
+		ValidateConfig ValidateConfig
+		ConfigFormat   DiagnosticsFormat `enum:"text,json,sarif" default:"text"`
+		Run            struct{}          `cmd:""`
+	}
+	validate := func(t *testing.T, config string, args ...string) (int, string) {
+		t.Helper()
+		dir, err := ioutil.TempDir("", "kong-hcl-")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "config.hcl")
+		require.NoError(t, ioutil.WriteFile(path, []byte(config), 0600))
+		status := -1
+		output := &strings.Builder{}
+		parser, err := kong.New(&cli,
+			Configuration(Loader, path, filepath.Join(dir, "missing.hcl")),
+			kong.Writers(output, output),
+			kong.Exit(func(code int) {
+				if status == -1 {
+					status = code
+				}
+			}))
+		require.NoError(t, err)
+		_, _ = parser.Parse(append([]string{"--validate-config", "run"}, args...))
+		return status, strings.Replace(output.String(), path, "config.hcl", -1)
+	}
+
+	status, output := validate(t, "port = 8080\nlevel = \"debug\"\n")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "", output)
+
+	status, output = validate(t, "port = \"eighty\"\nlevel = \"loud\"\nunknown = true\nold-flag = \"x\"\n")
+	assert.Equal(t, 1, status)
+	assert.Equal(t, `Error: Invalid configuration value
+
+  on config.hcl line 1:
+     1: port = "eighty"
+        ^
+
+Invalid value for "port": expected a valid 64 bit int but got "eighty".
+
+Error: Invalid configuration value
+
+  on config.hcl line 2:
+     2: level = "loud"
+        ^
+
+Invalid value for "level": must be one of "debug", "info" but got "loud".
+
+Error: Unknown configuration key
+
+  on config.hcl line 3:
+     3: unknown = true
+        ^
+
+Unknown configuration key "unknown".
+
+Warning: Deprecated configuration key
+
+  on config.hcl line 4:
+     4: old-flag = "x"
+        ^
+
+Configuration key "old-flag" is deprecated: use --level.
+`, output)
+
+	status, output = validate(t, "port = \"eighty\"\nold-flag = \"x\"\n", "--config-format=json")
+	assert.Equal(t, 1, status)
+	assert.Equal(t, `{"file":"config.hcl","range":{"start":{"line":1,"column":1},"end":{"line":1,"column":1}},"severity":"error","rule":"type-mismatch","summary":"Invalid configuration value","message":"Invalid value for \"port\": expected a valid 64 bit int but got \"eighty\"."}
+{"file":"config.hcl","range":{"start":{"line":2,"column":1},"end":{"line":2,"column":1}},"severity":"warning","rule":"deprecated","summary":"Deprecated configuration key","message":"Configuration key \"old-flag\" is deprecated: use --level."}
+`, output)
+
+	// Syntax errors are reported too, rather than failing kong.New.
+	status, output = validate(t, "port = [\n", "--config-format=json")
+	assert.Equal(t, 1, status)
+	assert.Equal(t, `{"file":"config.hcl","range":{"start":{"line":2,"column":1},"end":{"line":2,"column":1}},"severity":"error","rule":"invalid","summary":"Invalid expression","message":"Expected the start of an expression, but found an invalid expression token."}
+`, output)
+
+	// Without --validate-config they are returned by Parse.
+	w, err := ioutil.TempFile("", "kong-hcl-")
+	require.NoError(t, err)
+	defer os.Remove(w.Name())
+	_, _ = w.WriteString("port = [\n")
+	_ = w.Close()
+	parser, err := kong.New(&cli, Configuration(Loader, w.Name()))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"run"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Expected the start of an expression, but found an invalid expression token.")
+
+}
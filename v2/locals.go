@@ -0,0 +1,151 @@
+package konghcl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// The block type used to declare local values.
+const localsBlock = "locals"
+
+// Evaluates local values and top-level attributes in dependency order.
+type evaluator struct {
+	functions map[string]function.Function
+	exprs     map[string]hcl.Expression
+	values    map[string]cty.Value
+	stack     []string
+	diags     hcl.Diagnostics
+}
+
+// Build an EvalContext containing the values of the locals and top-level attributes of body, and
+// the given functions.
+//
+// Locals are declared in "locals" blocks and referenced as "local.<name>", while top-level
+// attributes are referenced by name. References are evaluated in dependency order, and
+// circular references are an error.
+func evalContext(body *hclsyntax.Body, functions map[string]function.Function) (*hcl.EvalContext, hcl.Diagnostics) {
+	e := &evaluator{functions: functions, exprs: map[string]hcl.Expression{}, values: map[string]cty.Value{}}
+	for name, attr := range body.Attributes {
+		e.exprs[name] = attr.Expr
+	}
+	for _, block := range body.Blocks {
+		if block.Type != localsBlock {
+			continue
+		}
+		if len(block.Labels) > 0 {
+			e.diags = append(e.diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unexpected locals label",
+				Detail:   "A locals block does not have labels.",
+				Subject:  block.LabelRanges[0].Ptr(),
+			})
+			continue
+		}
+		for name, attr := range block.Body.Attributes {
+			key := localsKey(name)
+			if _, ok := e.exprs[key]; ok {
+				e.diags = append(e.diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate local value",
+					Detail:   fmt.Sprintf("A local value named %q has already been declared.", name),
+					Subject:  attr.NameRange.Ptr(),
+				})
+				continue
+			}
+			e.exprs[key] = attr.Expr
+		}
+		for _, nested := range block.Body.Blocks {
+			e.diags = append(e.diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unexpected block",
+				Detail:   "A locals block may only contain attributes.",
+				Subject:  nested.TypeRange.Ptr(),
+			})
+		}
+	}
+	if e.diags.HasErrors() {
+		return nil, e.diags
+	}
+	keys := make([]string, 0, len(e.exprs))
+	for key := range e.exprs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e.eval(key)
+	}
+	return e.context(), e.diags
+}
+
+func (e *evaluator) eval(key string) cty.Value {
+	if value, ok := e.values[key]; ok {
+		return value
+	}
+	expr := e.exprs[key]
+	for i, visiting := range e.stack {
+		if visiting == key {
+			cycle := append(append([]string{}, e.stack[i:]...), key)
+			e.diags = append(e.diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Circular reference",
+				Detail:   fmt.Sprintf("%s refers to itself: %s.", key, strings.Join(cycle, " -> ")),
+				Subject:  expr.Range().Ptr(),
+			})
+			return cty.DynamicVal
+		}
+	}
+	e.stack = append(e.stack, key)
+	failed := len(e.diags.Errs())
+	for _, traversal := range expr.Variables() {
+		if dep := referenceKey(traversal); e.exprs[dep] != nil {
+			e.eval(dep)
+		}
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+	// Don't cascade errors from dependencies.
+	if len(e.diags.Errs()) > failed {
+		e.values[key] = cty.DynamicVal
+		return cty.DynamicVal
+	}
+	value, diags := expr.Value(e.context())
+	e.diags = append(e.diags, diags...)
+	e.values[key] = value
+	return value
+}
+
+// Build an EvalContext from the values evaluated so far.
+func (e *evaluator) context() *hcl.EvalContext {
+	locals := map[string]cty.Value{}
+	variables := map[string]cty.Value{}
+	for key, value := range e.values {
+		if strings.HasPrefix(key, localsKey("")) {
+			locals[strings.TrimPrefix(key, localsKey(""))] = value
+		} else {
+			variables[key] = value
+		}
+	}
+	variables["local"] = cty.ObjectVal(locals)
+	return &hcl.EvalContext{Variables: variables, Functions: e.functions}
+}
+
+func localsKey(name string) string {
+	return "local." + name
+}
+
+// The key of the local value or top-level attribute that a traversal refers to.
+func referenceKey(traversal hcl.Traversal) string {
+	root := traversal.RootName()
+	if root != "local" || len(traversal) < 2 {
+		return root
+	}
+	if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+		return localsKey(attr.Name)
+	}
+	return root
+}
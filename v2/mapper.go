@@ -0,0 +1,213 @@
+package konghcl
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/alecthomas/kong-hcl/core"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/pkg/errors"
+)
+
+// HCLFileMapper implements kong.MapperValue to decode an HCL file into
+// a struct field.
+//
+//	var cli struct {
+//	  Profile Profile `type:"hclfile"`
+//	}
+//
+//	func main() {
+//	  kong.Parse(&cli, kong.NamedMapper("hclfile", konghcl.HCLFileMapper))
+//	}
+//
+// Files with a ".json" extension, such as "profile.hcl.json", are decoded as HCL JSON.
+//
+// The flag may be repeated, or be a glob pattern matching several files, in which case each file
+// is decoded in turn and overrides the attributes and blocks set by earlier files. A map gains
+// the entries of each file instead.
+var HCLFileMapper = NewHCLFileMapper(nil) //nolint: gochecknoglobals
+
+// NewHCLFileMapper creates a mapper like HCLFileMapper, which evaluates expressions in the
+// file with ctx. ctx may be nil.
+func NewHCLFileMapper(ctx *hcl.EvalContext) kong.Mapper {
+	return kong.MapperFunc(func(dctx *kong.DecodeContext, target reflect.Value) error {
+		return decodeHCLFile(dctx, target, ctx)
+	})
+}
+
+// HCLFileDirMapper implements kong.MapperValue to decode each HCL file in a directory
+// into a map of structs, keyed by file name without extension.
+//
+//	var cli struct {
+//	  Jobs map[string]Job `type:"hclfiledir"`
+//	}
+//
+//	func main() {
+//	  kong.Parse(&cli, kong.NamedMapper("hclfiledir", konghcl.HCLFileDirMapper))
+//	}
+//
+// Files with a ".hcl", ".hcl.json" or ".json" extension are decoded, and all other files ignored.
+var HCLFileDirMapper = NewHCLFileDirMapper(nil) //nolint: gochecknoglobals
+
+// NewHCLFileDirMapper creates a mapper like HCLFileDirMapper, which evaluates expressions in the
+// files with ctx. ctx may be nil.
+func NewHCLFileDirMapper(ctx *hcl.EvalContext) kong.Mapper {
+	return kong.MapperFunc(func(dctx *kong.DecodeContext, target reflect.Value) error {
+		return decodeHCLFileDir(dctx, target, ctx)
+	})
+}
+
+func decodeHCLFile(ctx *kong.DecodeContext, target reflect.Value, evalCtx *hcl.EvalContext) error {
+	var pattern string
+	if err := ctx.Scan.PopValueInto("filename", &pattern); err != nil {
+		return err
+	}
+	files, err := core.ExpandFiles(pattern)
+	if err != nil {
+		return err
+	}
+	// gohcl decodes into structs and maps, so pointers are allocated and decoded through.
+	if target.Kind() == reflect.Ptr {
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		target = target.Elem()
+	}
+	for _, fname := range files {
+		// Each file is an element of a slice, or is decoded over the last, so later files
+		// override fields set by earlier ones.
+		if target.Kind() == reflect.Slice {
+			el, err := decodeNewFile(fname, target.Type().Elem(), evalCtx)
+			if err != nil {
+				return err
+			}
+			target.Set(reflect.Append(target, el))
+		} else if err := decodeFile(fname, target, evalCtx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeHCLFileDir(ctx *kong.DecodeContext, target reflect.Value, evalCtx *hcl.EvalContext) error {
+	var dir string
+	if err := ctx.Scan.PopValueInto("directory", &dir); err != nil {
+		return err
+	}
+	if target.Kind() != reflect.Map || target.Type().Key().Kind() != reflect.String {
+		return errors.Errorf("hclfiledir requires a map with string keys, not %s", target.Type())
+	}
+	keys, files, err := core.DirFiles(dir)
+	if err != nil {
+		return err
+	}
+	if target.IsNil() {
+		target.Set(reflect.MakeMap(target.Type()))
+	}
+	for _, key := range keys {
+		el, err := decodeNewFile(files[key], target.Type().Elem(), evalCtx)
+		if err != nil {
+			return err
+		}
+		target.SetMapIndex(reflect.ValueOf(key).Convert(target.Type().Key()), el)
+	}
+	return nil
+}
+
+// Decode a file into a new value of type t, which may be a pointer.
+func decodeNewFile(fname string, t reflect.Type, evalCtx *hcl.EvalContext) (reflect.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		el := reflect.New(t.Elem())
+		return el, decodeFile(fname, el.Elem(), evalCtx)
+	}
+	el := reflect.New(t).Elem()
+	return el, decodeFile(fname, el, evalCtx)
+}
+
+// Decode a file into target, overriding any fields it has already been decoded into.
+func decodeFile(fname string, target reflect.Value, evalCtx *hcl.EvalContext) error {
+	source, err := ioutil.ReadFile(fname) //nolint: gosec
+	if err != nil {
+		return err
+	}
+	ast, diags := parse(source, fname, strings.HasSuffix(fname, ".json"))
+	if diags.HasErrors() {
+		return diagnostics(fname, source, diags)
+	}
+	switch {
+	case target.Kind() != reflect.Struct && target.Kind() != reflect.Map:
+		return errors.Errorf("%s: can't decode into %s, which is not a struct or map", fname, target.Type())
+	case target.IsZero():
+		diags = gohcl.DecodeBody(ast.Body, evalCtx, target.Addr().Interface())
+	case target.Kind() == reflect.Struct:
+		diags = decodeOverride(ast.Body, evalCtx, target)
+	default:
+		diags = decodeMerge(ast.Body, evalCtx, target)
+	}
+	if diags.HasErrors() {
+		return diagnostics(fname, source, diags)
+	}
+	return nil
+}
+
+// Decode body into a map that has already been decoded from another file, replacing the
+// entries it sets.
+func decodeMerge(body hcl.Body, ctx *hcl.EvalContext, target reflect.Value) hcl.Diagnostics {
+	decoded := reflect.New(target.Type())
+	diags := gohcl.DecodeBody(body, ctx, decoded.Interface())
+	if diags.HasErrors() {
+		return diags
+	}
+	iter := decoded.Elem().MapRange()
+	for iter.Next() {
+		target.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return diags
+}
+
+// Decode body over a target that has already been decoded from another file.
+//
+// Only the attributes and blocks present in body replace those in target, and required
+// attributes and blocks may be omitted.
+func decodeOverride(body hcl.Body, ctx *hcl.EvalContext, target reflect.Value) hcl.Diagnostics {
+	decoded := reflect.New(target.Type())
+	var diags hcl.Diagnostics
+	missing := body.MissingItemRange()
+	for _, diag := range gohcl.DecodeBody(body, ctx, decoded.Interface()) {
+		// Missing required attributes and blocks are reported at the end of the body.
+		if diag.Subject != nil && *diag.Subject == missing {
+			continue
+		}
+		diags = append(diags, diag)
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+	schema, _ := gohcl.ImpliedBodySchema(decoded.Interface())
+	content, _, _ := body.PartialContent(schema)
+	blocks := content.Blocks.ByType()
+	for i := 0; i < target.NumField(); i++ {
+		tag := strings.Split(target.Type().Field(i).Tag.Get("hcl"), ",")
+		name, kind := tag[0], ""
+		if len(tag) > 1 {
+			kind = tag[1]
+		}
+		switch kind {
+		case "", "attr", "optional":
+			if content.Attributes[name] == nil {
+				continue
+			}
+		case "block":
+			if len(blocks[name]) == 0 {
+				continue
+			}
+		default:
+			continue
+		}
+		target.Field(i).Set(decoded.Elem().Field(i))
+	}
+	return diags
+}
@@ -0,0 +1,209 @@
+package konghcl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type TestSample struct {
+	Name string `hcl:"name"`
+	Game string `hcl:"game"`
+}
+
+func TestHCLFileMapper(t *testing.T) {
+	for _, filename := range []string{"testdata/sample.hcl", "testdata/sample.hcl.json"} {
+		var cli struct {
+			Sample TestSample `type:"hclfile"`
+		}
+		opt := kong.NamedMapper("hclfile", HCLFileMapper)
+		parser, err := kong.New(&cli, opt)
+		require.NoError(t, err)
+
+		_, err = parser.Parse([]string{"--sample", filename})
+		require.NoError(t, err)
+
+		want := TestSample{Name: "Lee Sedol", Game: "Go"}
+		require.Equal(t, want, cli.Sample, filename)
+	}
+}
+
+func TestHCLFileMapperPointer(t *testing.T) {
+	var cli struct {
+		Sample *TestSample `type:"hclfile"`
+	}
+	parser, err := kong.New(&cli, kong.NamedMapper("hclfile", HCLFileMapper))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"--sample", "testdata/sample.hcl"})
+	require.NoError(t, err)
+	require.Equal(t, &TestSample{Name: "Lee Sedol", Game: "Go"}, cli.Sample)
+
+	cli.Sample = nil
+	_, err = parser.Parse([]string{"--sample", "testdata/profiles/*.hcl"})
+	require.NoError(t, err)
+	require.Equal(t, &TestSample{Name: "Lee Sedol", Game: "Baduk"}, cli.Sample)
+}
+
+func TestHCLFileMapperEvalContext(t *testing.T) {
+	w, err := ioutil.TempFile("", "kong-hcl-*.hcl")
+	require.NoError(t, err)
+	defer os.Remove(w.Name())
+	_, err = w.WriteString("name = player\ngame = \"Go\"\n")
+	require.NoError(t, err)
+	_ = w.Close()
+
+	var cli struct {
+		Sample TestSample `type:"hclfile"`
+	}
+	ctx := &hcl.EvalContext{Variables: map[string]cty.Value{"player": cty.StringVal("Lee Sedol")}}
+	parser, err := kong.New(&cli, kong.NamedMapper("hclfile", NewHCLFileMapper(ctx)))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"--sample", w.Name()})
+	require.NoError(t, err)
+	require.Equal(t, TestSample{Name: "Lee Sedol", Game: "Go"}, cli.Sample)
+}
+
+func TestHCLFileMapperErr(t *testing.T) {
+	var cli struct {
+		Sample TestSample `type:"hclfile"`
+	}
+	opts := []kong.Option{
+		kong.NamedMapper("hclfile", HCLFileMapper),
+		kong.Exit(func(int) { fmt.Println("EXIT") }),
+	}
+	parser, err := kong.New(&cli, opts...)
+	require.NoError(t, err)
+
+	_, err = parser.Parse([]string{"--sample", "testdata/MISSING_FILE.hcl"})
+	require.Error(t, err)
+
+	_, err = parser.Parse([]string{"--sample"})
+	require.Error(t, err)
+
+	w, err := ioutil.TempFile("", "kong-hcl-*.hcl")
+	require.NoError(t, err)
+	defer os.Remove(w.Name())
+	_, err = w.WriteString("name = \"Lee Sedol\"\nrank = 9\ngame = \"Go\"\n")
+	require.NoError(t, err)
+	_ = w.Close()
+	_, err = parser.Parse([]string{"--sample", w.Name()})
+	require.EqualError(t, err, "--sample: Error: Unsupported argument\n\n"+
+		"  on "+w.Name()+" line 2:\n"+
+		"     2: rank = 9\n"+
+		"        ^^^^\n\n"+
+		"An argument named \"rank\" is not expected here.")
+}
+
+func TestHCLFileMapperMerge(t *testing.T) {
+	var cli struct {
+		Sample TestSample `type:"hclfile"`
+	}
+	parser, err := kong.New(&cli, kong.NamedMapper("hclfile", HCLFileMapper))
+	require.NoError(t, err)
+
+	_, err = parser.Parse([]string{"--sample", "testdata/profiles/1-base.hcl", "--sample", "testdata/profiles/2-override.hcl"})
+	require.NoError(t, err)
+	require.Equal(t, TestSample{Name: "Lee Sedol", Game: "Baduk"}, cli.Sample)
+
+	_, err = parser.Parse([]string{"--sample", "testdata/profiles/*.hcl"})
+	require.NoError(t, err)
+	require.Equal(t, TestSample{Name: "Lee Sedol", Game: "Baduk"}, cli.Sample)
+
+	_, err = parser.Parse([]string{"--sample", "testdata/profiles/*.missing"})
+	require.EqualError(t, err, `--sample: no files match "testdata/profiles/*.missing"`)
+
+	// Only the first file must contain required attributes.
+	_, err = parser.Parse([]string{"--sample", "testdata/profiles/2-override.hcl"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `The argument "name" is required`)
+}
+
+func TestHCLFileMapperMergeMap(t *testing.T) {
+	var cli struct {
+		Env  map[string]string `type:"hclfile"`
+		Rank int               `type:"hclfile"`
+	}
+	dir, err := ioutil.TempDir("", "kong-hcl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.hcl"), []byte("HOME = \"/root\"\nUSER = \"root\"\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.hcl"), []byte("USER = \"lee\"\n"), 0600))
+
+	parser, err := kong.New(&cli, kong.NamedMapper("hclfile", HCLFileMapper))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"--env", filepath.Join(dir, "*.hcl")})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"HOME": "/root", "USER": "lee"}, cli.Env)
+
+	_, err = parser.Parse([]string{"--rank", filepath.Join(dir, "b.hcl")})
+	require.EqualError(t, err, "--rank: "+filepath.Join(dir, "b.hcl")+": can't decode into int, which is not a struct or map")
+}
+
+func TestHCLFileMapperMergeBlocks(t *testing.T) {
+	type rules struct {
+		Komi float64 `hcl:"komi"`
+	}
+	var cli struct {
+		Game struct {
+			Name  string `hcl:"name,optional"`
+			Rules *rules `hcl:"rules,block"`
+		} `type:"hclfile"`
+	}
+	dir, err := ioutil.TempDir("", "kong-hcl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.hcl"), []byte("name = \"go\"\nrules {\n  komi = 6.5\n}\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.hcl"), []byte("name = \"baduk\"\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "c.hcl.json"), []byte(`{"rules": {"komi": 7.5}}`), 0600))
+
+	parser, err := kong.New(&cli, kong.NamedMapper("hclfile", HCLFileMapper))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"--game", filepath.Join(dir, "*.hcl")})
+	require.NoError(t, err)
+	require.Equal(t, "baduk", cli.Game.Name)
+	require.Equal(t, &rules{Komi: 6.5}, cli.Game.Rules)
+
+	_, err = parser.Parse([]string{"--game", filepath.Join(dir, "*.hcl"), "--game", filepath.Join(dir, "c.hcl.json")})
+	require.NoError(t, err)
+	require.Equal(t, "baduk", cli.Game.Name)
+	require.Equal(t, &rules{Komi: 7.5}, cli.Game.Rules)
+}
+
+func TestHCLFileMapperSlice(t *testing.T) {
+	var cli struct {
+		Samples []TestSample `type:"hclfile"`
+	}
+	parser, err := kong.New(&cli, kong.NamedMapper("hclfile", HCLFileMapper))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"--samples", "testdata/sample.hcl", "--samples", "testdata/profiles/1-base.hcl"})
+	require.NoError(t, err)
+	require.Equal(t, []TestSample{{Name: "Lee Sedol", Game: "Go"}, {Name: "Lee Sedol", Game: "Go"}}, cli.Samples)
+
+	_, err = parser.Parse([]string{"--samples", "testdata/jobs/*.hcl*"})
+	require.NoError(t, err)
+	require.Equal(t, []TestSample{{Name: "Build", Game: "Go"}, {Name: "Deploy", Game: "Chess"}}, cli.Samples)
+}
+
+func TestHCLFileDirMapper(t *testing.T) {
+	var cli struct {
+		Jobs map[string]TestSample `type:"hclfiledir"`
+	}
+	parser, err := kong.New(&cli, kong.NamedMapper("hclfiledir", HCLFileDirMapper))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"--jobs", "testdata/jobs"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]TestSample{
+		"build":  {Name: "Build", Game: "Go"},
+		"deploy": {Name: "Deploy", Game: "Chess"},
+	}, cli.Jobs)
+
+	_, err = parser.Parse([]string{"--jobs", "testdata/missing"})
+	require.Error(t, err)
+}
@@ -0,0 +1,75 @@
+// Command migrate converts kong-hcl configuration files from HCL1 to HCL2.
+//
+// Each file is converted with migrate.Convert and verified with migrate.Verify. The converted
+// configuration is printed, or written back to the file with --write, only if it resolves to the
+// same values as the original.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/alecthomas/kong"
+	"github.com/alecthomas/kong-hcl/core"
+	"github.com/alecthomas/kong-hcl/v2/migrate"
+	"github.com/pkg/errors"
+)
+
+var cli struct {
+	Write bool     `short:"w" help:"Write the converted configuration back to each file, rather than to stdout."`
+	Force bool     `help:"Write the converted configuration even if its values differ from the original."`
+	Files []string `arg:"" type:"existingfile" help:"HCL1 configuration files to convert."`
+}
+
+func main() {
+	ctx := kong.Parse(&cli, kong.Description("Convert kong-hcl configuration files from HCL1 to HCL2."))
+	status := 0
+	for _, path := range cli.Files {
+		if err := migrateFile(path); err != nil {
+			printError(err)
+			status = 1
+		}
+	}
+	ctx.Exit(status)
+}
+
+// Print err to stderr, with diagnostics in colour if stderr is a terminal.
+func printError(err error) {
+	if diagnostics, ok := errors.Cause(err).(*core.Diagnostics); ok {
+		_ = diagnostics.Write(os.Stderr, core.IsTerminal(os.Stderr))
+		return
+	}
+	fmt.Fprintln(os.Stderr, err)
+}
+
+func migrateFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	source, err := ioutil.ReadFile(path) // nolint: gosec
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	converted, diagnostics, err := migrate.Convert(path, source)
+	if err != nil {
+		return err
+	}
+	if len(diagnostics) > 0 {
+		printError(core.NewDiagnostics(path, source, diagnostics...))
+		fmt.Fprintln(os.Stderr)
+	}
+	if err := migrate.Verify(path, source, converted); err != nil {
+		printError(err)
+		if !cli.Force {
+			fmt.Fprintln(os.Stderr)
+			return errors.Errorf("%s: not converted, as its values would change (use --force to convert it anyway)", path)
+		}
+	}
+	if !cli.Write {
+		_, err := os.Stdout.Write(converted)
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(ioutil.WriteFile(path, converted, info.Mode()))
+}
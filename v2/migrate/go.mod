@@ -0,0 +1,22 @@
+module github.com/alecthomas/kong-hcl/v2/migrate
+
+go 1.14
+
+require (
+	github.com/alecthomas/kong v0.2.17
+	github.com/alecthomas/kong-hcl v1.1.0
+	github.com/alecthomas/kong-hcl/core v0.1.0
+	github.com/alecthomas/kong-hcl/v2 v2.1.0
+	github.com/hashicorp/hcl v1.0.0
+	github.com/hashicorp/hcl/v2 v2.0.0
+	github.com/pkg/errors v0.9.1
+	github.com/stretchr/testify v1.7.0
+	github.com/zclconf/go-cty v1.1.0
+)
+
+// Build against the modules in this repository; users of this module get the versions required above.
+replace (
+	github.com/alecthomas/kong-hcl => ../../
+	github.com/alecthomas/kong-hcl/core => ../../core
+	github.com/alecthomas/kong-hcl/v2 => ../
+)
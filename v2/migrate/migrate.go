@@ -0,0 +1,461 @@
+// Package migrate converts configuration written for version 1 of kong-hcl, in HCL1, into
+// equivalent configuration for version 2, in HCL2.
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "github.com/alecthomas/kong-hcl"
+	"github.com/alecthomas/kong-hcl/core"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	hclstrconv "github.com/hashicorp/hcl/hcl/strconv"
+	"github.com/hashicorp/hcl/hcl/token"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// The block that declares local values in HCL2.
+const localsBlock = "locals"
+
+// Convert converts the HCL1 configuration in source to HCL2, returning the converted source and a
+// diagnostic for each part of the configuration whose meaning could not be preserved.
+//
+// Forms that only HCL1 supports are rewritten to their HCL2 equivalents:
+//
+//   - Keys followed by further keys, eg. `nested first { ... }`, become labelled blocks,
+//     eg. `nested "first" { ... }`.
+//   - Objects assigned to keys, eg. `db = { ... }`, become blocks.
+//   - Lists assigned to the same key more than once are merged into one list, as HCL1 does.
+//     Other values set more than once keep only the last value.
+//   - Hexadecimal and octal numbers are written in decimal, as HCL2 reads "010" as ten.
+//   - "${" and "%{" in strings are escaped, as HCL2 would interpolate them.
+//
+// Comments are kept. Keys that are not valid HCL2 identifiers, and top-level "locals" blocks,
+// which declare local values in HCL2, can't be converted and are left out.
+//
+// The source must be HCL1 native syntax that version 1 can load. JSON is an error, as version 2
+// can load it as it is.
+func Convert(filename string, source []byte) ([]byte, []core.Diagnostic, error) {
+	if strings.HasSuffix(filename, ".json") || bytes.HasPrefix(bytes.TrimSpace(source), []byte("{")) {
+		return nil, nil, errors.Errorf("%s: JSON configuration can be loaded by version 2 as it is", filename)
+	}
+	// Only configuration that version 1 loads is converted, so that it can be verified.
+	if _, err := load(v1.Loader, filename, source); err != nil {
+		return nil, nil, err
+	}
+	file, err := hcl.ParseBytes(source)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, filename)
+	}
+	list, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, nil, errors.Errorf("%s: unexpected %T at top level", filename, file.Node)
+	}
+	c := &converter{filename: filename, comments: file.Comments}
+	if err := c.body(list, true); err != nil {
+		if e, ok := err.(*invalidError); ok {
+			pos := core.Position{Filename: filename, Line: e.pos.Line, Column: e.pos.Column}
+			err = core.NewDiagnostics(filename, source, core.Diagnostic{
+				Summary: "Invalid HCL",
+				Detail:  fmt.Sprintf("Failed to convert: %s.", e.msg),
+				Pos:     pos,
+			})
+		}
+		return nil, nil, err
+	}
+	c.flush(token.Pos{Line: int(^uint(0) >> 1)})
+	return hclwrite.Format(c.out.Bytes()), c.diags, nil
+}
+
+type converter struct {
+	filename string
+	out      bytes.Buffer
+	diags    []core.Diagnostic
+	// Comments that have not been written yet, in source order.
+	comments []*ast.CommentGroup
+	// The last source line converted, or 0 if nothing has been written.
+	line int
+}
+
+// Convert the items in a body, which is at the top level if top is true.
+func (c *converter) body(list *ast.ObjectList, top bool) error {
+	items, dropped, err := merge(list.Items)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		key := item.Keys[0]
+		name, err := keyName(key)
+		if err != nil {
+			return err
+		}
+		end := endPos(item.Val)
+		switch {
+		case dropped[item]:
+			c.flush(item.Pos())
+			if end.Line > c.line {
+				c.line = end.Line
+			}
+			continue
+		case !hclsyntax.ValidIdentifier(name):
+			c.leaveOut(key, end, "Unsupported key", fmt.Sprintf("%q is not a valid HCL2 identifier, so it was left out.", name))
+			continue
+		case top && name == localsBlock && isObject(item.Val):
+			c.leaveOut(key, end, "Reserved block", fmt.Sprintf("%q blocks declare local values in HCL2, so it was left out.", name))
+			continue
+		}
+		if object, ok := item.Val.(*ast.ObjectType); ok {
+			header := name
+			for _, label := range item.Keys[1:] {
+				labelName, err := keyName(label)
+				if err != nil {
+					return err
+				}
+				header += " " + quote(labelName)
+			}
+			c.flush(item.Pos())
+			c.write(header+" {", item.Pos().Line, object.Lbrace.Line)
+			if err := c.body(object.List, false); err != nil {
+				return err
+			}
+			c.flush(object.Rbrace)
+			c.write("}", object.Rbrace.Line, object.Rbrace.Line)
+			c.trailing(object.Rbrace)
+			continue
+		}
+		// Comments inside the value are written before it.
+		c.flush(end)
+		expr, err := value(item.Val, true)
+		if err != nil {
+			return err
+		}
+		c.write(name+" = "+expr, item.Pos().Line, end.Line)
+		// Nothing may follow the marker that ends a heredoc.
+		if !strings.HasPrefix(expr, "<<") {
+			c.trailing(end)
+		}
+	}
+	return nil
+}
+
+// Merge items that set the same attribute, as decoding HCL1 does.
+//
+// Lists are concatenated, while other values are replaced by the last one. The merged item
+// takes the place of the first, and the others are returned as dropped.
+func merge(items []*ast.ObjectItem) (out []*ast.ObjectItem, dropped map[*ast.ObjectItem]bool, err error) {
+	byName := map[string][]*ast.ObjectItem{}
+	names := map[*ast.ObjectItem]string{}
+	for _, item := range items {
+		if len(item.Keys) == 1 && !isObject(item.Val) {
+			name, err := keyName(item.Keys[0])
+			if err != nil {
+				return nil, nil, err
+			}
+			byName[name] = append(byName[name], item)
+			names[item] = name
+		}
+	}
+	out = make([]*ast.ObjectItem, 0, len(items))
+	dropped = map[*ast.ObjectItem]bool{}
+	for _, item := range items {
+		if len(item.Keys) != 1 || isObject(item.Val) {
+			out = append(out, item)
+			continue
+		}
+		set := byName[names[item]]
+		if set[0] != item {
+			dropped[item] = true
+			out = append(out, item)
+			continue
+		}
+		merged := *item
+		merged.Val = set[len(set)-1].Val
+		if list, ok := item.Val.(*ast.ListType); ok && allLists(set) {
+			combined := *list
+			combined.List = nil
+			for _, el := range set {
+				combined.List = append(combined.List, el.Val.(*ast.ListType).List...)
+			}
+			merged.Val = &combined
+		}
+		out = append(out, &merged)
+	}
+	return out, dropped, nil
+}
+
+func allLists(items []*ast.ObjectItem) bool {
+	for _, item := range items {
+		if _, ok := item.Val.(*ast.ListType); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Report that the item named by key, ending at end, was left out, and discard its comments.
+func (c *converter) leaveOut(key *ast.ObjectKey, end token.Pos, summary, detail string) {
+	pos := key.Pos()
+	c.diags = append(c.diags, core.Diagnostic{
+		Severity: core.SeverityWarning,
+		Summary:  summary,
+		Detail:   detail,
+		Pos:      core.Position{Filename: c.filename, Line: pos.Line, Column: pos.Column},
+		End:      core.Position{Filename: c.filename, Line: pos.Line, Column: pos.Column + len(key.Token.Text)},
+	})
+	for len(c.comments) > 0 && before(c.comments[0].Pos(), end) {
+		if before(c.comments[0].Pos(), key.Pos()) {
+			c.writeComments(c.comments[0])
+		}
+		c.comments = c.comments[1:]
+	}
+}
+
+// Write the comments that start before pos.
+func (c *converter) flush(pos token.Pos) {
+	for len(c.comments) > 0 && before(c.comments[0].Pos(), pos) {
+		c.writeComments(c.comments[0])
+		c.comments = c.comments[1:]
+	}
+}
+
+// Append a comment following pos on the same line to the last line written.
+func (c *converter) trailing(pos token.Pos) {
+	if len(c.comments) == 0 {
+		return
+	}
+	group := c.comments[0]
+	if len(group.List) != 1 || group.Pos().Line != pos.Line || strings.Contains(group.List[0].Text, "\n") {
+		return
+	}
+	c.out.Truncate(c.out.Len() - 1)
+	c.out.WriteString(" " + group.List[0].Text + "\n")
+	c.comments = c.comments[1:]
+}
+
+func (c *converter) writeComments(group *ast.CommentGroup) {
+	for _, comment := range group.List {
+		line := comment.Pos().Line
+		c.write(comment.Text, line, line+strings.Count(comment.Text, "\n"))
+	}
+}
+
+// Write text converted from the source lines start to end, after a blank line if there is one
+// in the source.
+func (c *converter) write(text string, start, end int) {
+	if c.line > 0 && start > c.line+1 {
+		c.out.WriteString("\n")
+	}
+	c.out.WriteString(text + "\n")
+	if end > c.line {
+		c.line = end
+	}
+}
+
+// Convert a value to an HCL2 expression. Multi-line strings are written as heredocs if heredoc
+// is true.
+func value(node ast.Node, heredoc bool) (string, error) {
+	switch node := node.(type) {
+	case *ast.LiteralType:
+		v, err := tokenValue(node.Token)
+		if err != nil {
+			return "", err
+		}
+		switch v := v.(type) {
+		case string:
+			if heredoc {
+				if doc, ok := heredocString(v); ok {
+					return doc, nil
+				}
+			}
+			return quote(v), nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		default:
+			return "", invalid(node.Pos(), "unsupported value %q", node.Token.Text)
+		}
+	case *ast.ListType:
+		elements := make([]string, 0, len(node.List))
+		for _, el := range node.List {
+			element, err := value(el, false)
+			if err != nil {
+				return "", err
+			}
+			elements = append(elements, element)
+		}
+		return "[" + strings.Join(elements, ", ") + "]", nil
+	case *ast.ObjectType:
+		attrs := make([]string, 0, len(node.List.Items))
+		items, dropped, err := merge(node.List.Items)
+		if err != nil {
+			return "", err
+		}
+		for _, item := range items {
+			if dropped[item] {
+				continue
+			}
+			v, err := value(item.Val, false)
+			if err != nil {
+				return "", err
+			}
+			names := make([]string, len(item.Keys))
+			for i, key := range item.Keys {
+				if names[i], err = keyName(key); err != nil {
+					return "", err
+				}
+			}
+			for i := len(names) - 1; i > 0; i-- {
+				v = "{ " + objectKey(names[i]) + " = " + v + " }"
+			}
+			attrs = append(attrs, objectKey(names[0])+" = "+v)
+		}
+		if len(attrs) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(attrs, ", ") + " }", nil
+	default:
+		return "", invalid(node.Pos(), "unsupported value of type %T", node)
+	}
+}
+
+// Write s as a heredoc, if it consists of whole lines that can be written literally.
+func heredocString(s string) (string, bool) {
+	if strings.Count(s, "\n") < 2 || !strings.HasSuffix(s, "\n") || strings.ContainsAny(s, "\r") {
+		return "", false
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	marker := "EOF"
+	for i := 0; containsLine(lines, marker); i++ {
+		marker = fmt.Sprintf("EOF%d", i)
+	}
+	out := "<<" + marker + "\n"
+	for _, line := range lines {
+		out += escapeTemplate(line) + "\n"
+	}
+	return out + marker, true
+}
+
+func containsLine(lines []string, marker string) bool {
+	for _, line := range lines {
+		if strings.TrimSpace(line) == marker {
+			return true
+		}
+	}
+	return false
+}
+
+// Escape template sequences, which HCL1 did not interpret.
+func escapeTemplate(s string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(s)
+}
+
+// Quote s as an HCL2 string literal.
+func quote(s string) string {
+	return string(hclwrite.TokensForValue(cty.StringVal(s)).Bytes())
+}
+
+func objectKey(name string) string {
+	if hclsyntax.ValidIdentifier(name) {
+		return name
+	}
+	return quote(name)
+}
+
+func keyName(key *ast.ObjectKey) (string, error) {
+	v, err := tokenValue(key.Token)
+	if err != nil {
+		return "", err
+	}
+	if name, ok := v.(string); ok {
+		return name, nil
+	}
+	return key.Token.Text, nil
+}
+
+// The value of a token. Token.Value panics if the token is malformed, so it is checked first.
+func tokenValue(tok token.Token) (interface{}, error) {
+	var err error
+	switch tok.Type {
+	case token.BOOL:
+		if tok.Text != "true" && tok.Text != "false" {
+			err = errors.Errorf("invalid bool %q", tok.Text)
+		}
+	case token.FLOAT:
+		_, err = strconv.ParseFloat(tok.Text, 64)
+	case token.NUMBER:
+		_, err = strconv.ParseInt(tok.Text, 0, 64)
+	case token.IDENT:
+	case token.HEREDOC:
+		if i := strings.IndexByte(tok.Text, '\n'); i < 2 || len(tok.Text) < 2*i {
+			err = errors.Errorf("invalid heredoc")
+		}
+	case token.STRING:
+		unquote := hclstrconv.Unquote
+		if tok.JSON {
+			unquote = strconv.Unquote
+		}
+		if tok.Text != "" {
+			_, err = unquote(tok.Text)
+		}
+	default:
+		err = errors.Errorf("unsupported token %s", tok.Type)
+	}
+	if err != nil {
+		return nil, invalid(tok.Pos, "%s", errors.Cause(err))
+	}
+	return tok.Value(), nil
+}
+
+// An error converting the source at pos.
+type invalidError struct {
+	pos token.Pos
+	msg string
+}
+
+func invalid(pos token.Pos, format string, args ...interface{}) error {
+	return &invalidError{pos: pos, msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *invalidError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.pos.Line, e.pos.Column, e.msg)
+}
+
+func isObject(node ast.Node) bool {
+	_, ok := node.(*ast.ObjectType)
+	return ok
+}
+
+// The position of the end of a value.
+func endPos(node ast.Node) token.Pos {
+	switch node := node.(type) {
+	case *ast.ObjectType:
+		return node.Rbrace
+	case *ast.ListType:
+		return node.Rbrack
+	case *ast.LiteralType:
+		pos := node.Token.Pos
+		text := node.Token.Text
+		if i := strings.LastIndex(text, "\n"); i >= 0 {
+			pos.Line += strings.Count(text, "\n")
+			pos.Column = 1
+			text = text[i+1:]
+		}
+		pos.Column += len(text)
+		return pos
+	default:
+		return node.Pos()
+	}
+}
+
+func before(a, b token.Pos) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
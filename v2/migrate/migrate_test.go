@@ -0,0 +1,159 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	v1 "github.com/alecthomas/kong-hcl"
+	"github.com/alecthomas/kong-hcl/core"
+	konghcl "github.com/alecthomas/kong-hcl/v2"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	source := `# Header comment.
+port = 0x1F90 # In hex.
+mode = 0755
+
+hosts = ["a"]
+hosts = ["b", "c"]
+name = "first"
+name = "${not} %{interpolated}"
+
+db = {
+  dsn = "root@/database"
+}
+
+nested first {
+  // Inside.
+  ratio = 1.5
+}
+
+motd = <<EOT
+hello
+  ${world}
+EOT
+`
+	converted, diags, err := Convert("config.hcl", []byte(source))
+	require.NoError(t, err)
+	require.Empty(t, diags)
+	require.Equal(t, `# Header comment.
+port = 8080 # In hex.
+mode = 493
+
+hosts = ["a", "b", "c"]
+name  = "$${not} %%{interpolated}"
+
+db {
+  dsn = "root@/database"
+}
+
+nested "first" {
+  // Inside.
+  ratio = 1.5
+}
+
+motd = <<EOF
+hello
+  $${world}
+EOF
+`, string(converted))
+	require.NoError(t, Verify("config.hcl", []byte(source), converted))
+
+	// Flags resolve to the same values with either version.
+	type config struct {
+		Port  int
+		Mode  int
+		Hosts []string
+		Name  string
+		DB    struct {
+			DSN string
+		} `embed:"" prefix:"db-"`
+		Nested struct {
+			Ratio float64
+		} `embed:"" prefix:"nested-first-"`
+		Motd string
+	}
+	resolve := func(loader kong.ConfigurationLoader, source string) config {
+		var cli config
+		resolver, err := loader(strings.NewReader(source))
+		require.NoError(t, err)
+		parser, err := kong.New(&cli, kong.Resolvers(resolver))
+		require.NoError(t, err)
+		_, err = parser.Parse(nil)
+		require.NoError(t, err)
+		return cli
+	}
+	require.Equal(t, resolve(v1.Loader, source), resolve(konghcl.Loader, string(converted)))
+}
+
+func TestConvertUnsupported(t *testing.T) {
+	source := `port = 8080
+"bad key" = 1
+locals {
+  # Gone.
+  x = 1
+}
+`
+	converted, diags, err := Convert("config.hcl", []byte(source))
+	require.NoError(t, err)
+	require.Equal(t, "port = 8080\n", string(converted))
+	require.Equal(t, []core.Diagnostic{
+		{
+			Severity: core.SeverityWarning,
+			Summary:  "Unsupported key",
+			Detail:   `"bad key" is not a valid HCL2 identifier, so it was left out.`,
+			Pos:      core.Position{Filename: "config.hcl", Line: 2, Column: 1},
+			End:      core.Position{Filename: "config.hcl", Line: 2, Column: 10},
+		},
+		{
+			Severity: core.SeverityWarning,
+			Summary:  "Reserved block",
+			Detail:   `"locals" blocks declare local values in HCL2, so it was left out.`,
+			Pos:      core.Position{Filename: "config.hcl", Line: 3, Column: 1},
+			End:      core.Position{Filename: "config.hcl", Line: 3, Column: 7},
+		},
+	}, diags)
+
+	err = Verify("config.hcl", []byte(source), converted)
+	require.EqualError(t, err, `Error: Changed configuration value
+
+"bad key" is 1 in HCL1, but unset in HCL2.
+
+Error: Changed configuration value
+
+"locals" is [{"x":1}] in HCL1, but unset in HCL2.`)
+}
+
+func TestConvertErrors(t *testing.T) {
+	_, _, err := Convert("config.json", []byte(`{"port": 8080}`))
+	require.EqualError(t, err, "config.json: JSON configuration can be loaded by version 2 as it is")
+
+	_, _, err = Convert("config.hcl", []byte("port = ["))
+	require.Error(t, err)
+	require.NotNil(t, core.DiagnosticsOf(err))
+}
+
+func TestValueErrors(t *testing.T) {
+	pos := token.Pos{Line: 2, Column: 8}
+	_, err := value(&ast.LiteralType{Token: token.Token{Type: token.NUMBER, Pos: pos, Text: "99999999999999999999"}}, false)
+	require.EqualError(t, err, `2:8: strconv.ParseInt: parsing "99999999999999999999": value out of range`)
+
+	_, err = value(&ast.ListType{List: []ast.Node{
+		&ast.LiteralType{Token: token.Token{Type: token.STRING, Pos: pos, Text: `"unterminated`}},
+	}}, false)
+	require.EqualError(t, err, "2:8: invalid syntax")
+
+	_, err = keyName(&ast.ObjectKey{Token: token.Token{Type: token.HEREDOC, Pos: pos, Text: "<<EOF"}})
+	require.EqualError(t, err, "2:8: invalid heredoc")
+}
+
+func TestVerify(t *testing.T) {
+	err := Verify("config.hcl", []byte("port = 8080\ndb { dsn = \"a\" }\n"), []byte("port = 8080.0\ndb { dsn = \"b\" }\n"))
+	require.EqualError(t, err, `Error: Changed configuration value
+
+"db" is [{"dsn":"a"}] in HCL1, but [{"dsn":"b"}] in HCL2.`)
+}
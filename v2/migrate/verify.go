@@ -0,0 +1,176 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	v1 "github.com/alecthomas/kong-hcl"
+	"github.com/alecthomas/kong-hcl/core"
+	konghcl "github.com/alecthomas/kong-hcl/v2"
+	"github.com/pkg/errors"
+)
+
+// Verify loads "before", HCL1 configuration, with the Loader of version 1 and "after", its HCL2
+// conversion, with the Loader of version 2, and returns an error describing each key whose
+// value differs between them.
+//
+// Values are compared as they are resolved, so a number written in octal in "before" and in
+// decimal in "after" is the same, as is an integer written as a float. Where the values of
+// a block differ, only the block is reported.
+func Verify(filename string, before, after []byte) error {
+	from, err := load(v1.Loader, filename, before)
+	if err != nil {
+		return err
+	}
+	to, err := load(konghcl.Loader, filename, after)
+	if err != nil {
+		return err
+	}
+	diags := core.NewDiagnostics(filename, before)
+	reported := []string{}
+	for _, key := range prefixes(from.Keys(), to.Keys()) {
+		if hasPrefix(key, reported) {
+			continue
+		}
+		a, _ := from.Get(key)
+		b, _ := to.Get(key)
+		if equal(a, b) {
+			continue
+		}
+		reported = append(reported, key)
+		diags.Diagnostics = append(diags.Diagnostics, core.Diagnostic{
+			Summary: "Changed configuration value",
+			Detail:  fmt.Sprintf("%q is %s in HCL1, but %s in HCL2.", key, describe(a), describe(b)),
+		})
+	}
+	if len(diags.Diagnostics) > 0 {
+		return diags
+	}
+	return nil
+}
+
+// Load source with loader.
+func load(loader kong.ConfigurationLoader, filename string, source []byte) (*core.Resolver, error) {
+	resolver, err := loader(&namedReader{Reader: bytes.NewReader(source), name: filename})
+	if err != nil {
+		return nil, err
+	}
+	r, ok := resolver.(*core.Resolver)
+	if !ok {
+		return nil, errors.Errorf("%s: unexpected resolver %T", filename, resolver)
+	}
+	return r, nil
+}
+
+// A reader that names the file it reads, so that loaders report positions in it.
+type namedReader struct {
+	*bytes.Reader
+	name string
+}
+
+func (n *namedReader) Name() string { return n.name }
+
+// The sorted keys in either set, and every hyphen-separated prefix of them, shortest first.
+func prefixes(a, b []string) []string {
+	seen := map[string]bool{}
+	for _, key := range append(append([]string{}, a...), b...) {
+		parts := strings.Split(key, "-")
+		for i := 1; i <= len(parts); i++ {
+			seen[strings.Join(parts[:i], "-")] = true
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for key := range seen {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Returns true if key is below any of the keys in prefixes.
+func hasPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare configuration values, with numbers equal if their values are.
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case nil, bool, string:
+		return a == b
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case []map[string]interface{}:
+		b, ok := b.([]map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		x, ok := number(a)
+		y, ok2 := number(b)
+		return ok && ok2 && x.Cmp(y) == 0
+	}
+}
+
+func number(v interface{}) (*big.Float, bool) {
+	switch v := v.(type) {
+	case int:
+		return new(big.Float).SetInt64(int64(v)), true
+	case int64:
+		return new(big.Float).SetInt64(v), true
+	case uint64:
+		return new(big.Float).SetUint64(v), true
+	case float64:
+		return big.NewFloat(v), true
+	default:
+		return nil, false
+	}
+}
+
+// Describe a value for a diagnostic.
+func describe(v interface{}) string {
+	if v == nil {
+		return "unset"
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(out)
+}
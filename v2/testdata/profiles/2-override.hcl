@@ -0,0 +1 @@
+game = "Baduk"
@@ -0,0 +1,26 @@
+package konghcl
+
+import (
+	"github.com/alecthomas/kong-hcl/core"
+)
+
+// ByteSize is a number of bytes that can be configured with a decimal ("10MB") or binary ("10MiB") unit.
+//
+// See core.ByteSize for details.
+type ByteSize = core.ByteSize
+
+// ByteSizeMapper decodes byte sizes with optional units into any integer field.
+//
+//	var cli struct {
+//	  MaxBody int64 `type:"bytesize"`
+//	}
+//
+//	func main() {
+//	  kong.Parse(&cli, kong.NamedMapper("bytesize", konghcl.ByteSizeMapper))
+//	}
+var ByteSizeMapper = core.ByteSizeMapper
+
+// ParseByteSize parses a byte size such as "512", "10MB" or "1.5GiB" into a number of bytes.
+func ParseByteSize(s string) (int64, error) {
+	return core.ParseByteSize(s)
+}
@@ -0,0 +1,79 @@
+package konghcl
+
+import (
+	"github.com/alecthomas/kong"
+	"github.com/alecthomas/kong-hcl/core"
+)
+
+// ConfigFiles are the configuration files of an application and the loader that loads them.
+type ConfigFiles = core.ConfigFiles
+
+// Configuration loads configuration files like kong.Configuration, and also makes them
+// available to ValidateConfig.
+//
+// A file that fails to load is reported by ValidateConfig, or otherwise returned as an error by
+// Parse, rather than by kong.New.
+//
+//	parser, err := kong.New(&cli, konghcl.Configuration(konghcl.Loader, "/etc/myapp.hcl", "~/.myapp.hcl"))
+func Configuration(loader kong.ConfigurationLoader, paths ...string) kong.Option {
+	return core.Configuration(loader, paths...)
+}
+
+// DiagnosticsFormat is a format that configuration problems can be written in.
+//
+// Adding a flag of this type selects the format used by ValidateConfig:
+//
+//	var cli struct {
+//	  ValidateConfig konghcl.ValidateConfig    `help:"Validate configuration files and exit."`
+//	  ConfigFormat   konghcl.DiagnosticsFormat `help:"Format of configuration problems." enum:"text,json,sarif" default:"text"`
+//	}
+type DiagnosticsFormat = core.DiagnosticsFormat
+
+// Diagnostics formats.
+const (
+	DiagnosticsText  = core.DiagnosticsText
+	DiagnosticsJSON  = core.DiagnosticsJSON
+	DiagnosticsSARIF = core.DiagnosticsSARIF
+)
+
+// DiagnosticsOf converts an error returned by a Loader, Resolver.Validate or DecodeValue into
+// diagnostics, which may be written in any DiagnosticsFormat with WriteFormat.
+func DiagnosticsOf(err error) *core.Diagnostics {
+	return core.DiagnosticsOf(err)
+}
+
+// FatalIfErrorf terminates app with an error message if err is not nil, as app.FatalIfErrorf
+// does, except that configuration errors are written in colour if stderr is a terminal.
+//
+//	ctx, err := parser.Parse(os.Args[1:])
+//	konghcl.FatalIfErrorf(parser, err)
+func FatalIfErrorf(app *kong.Kong, err error, args ...interface{}) {
+	core.FatalIfErrorf(app, err, args...)
+}
+
+// ValidateConfig can be added as a flag to validate configuration files and exit.
+//
+// Every file passed to Configuration is checked for unknown and deprecated keys and for values
+// that cannot be decoded into their flags, and each problem is reported with its position, in
+// the format selected by any DiagnosticsFormat flag. The exit status is non-zero if there are
+// any errors, and the selected command is not run.
+type ValidateConfig bool
+
+func (f ValidateConfig) BeforeResolve(app *kong.Kong, ctx *kong.Context, files ConfigFiles) error { // nolint: golint
+	format := DiagnosticsText
+	for _, flag := range ctx.Flags() {
+		if selected, ok := ctx.FlagValue(flag).(DiagnosticsFormat); ok {
+			format = selected
+		}
+	}
+	valid, err := core.ValidateConfig(app, files, format)
+	if err != nil {
+		return err
+	}
+	status := 0
+	if !valid {
+		status = 1
+	}
+	app.Exit(status)
+	return nil
+}